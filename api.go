@@ -0,0 +1,183 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+const (
+	apiDefaultLimit = 50
+	apiMaxLimit     = 500
+)
+
+// apiItem: item trả qua API, kèm id ổn định và source đã suy ra.
+type apiItem struct {
+	ID string `json:"id"`
+	Item
+	Source string `json:"source"`
+}
+
+// itemID: id ổn định của item = 16 hex đầu sha256(pdf_url); catalog gộp
+// item trùng pdf_url (uniqueByPDFURL) nên id không đụng nhau.
+func itemID(it Item) string {
+	sum := sha256.Sum256([]byte(itemKey(it)))
+	return hex.EncodeToString(sum[:8])
+}
+
+// itemSource: Source đã cào ra item; data cũ chưa có field source thì lấy
+// host của detail_url (hoặc pdf_url), bỏ "www.".
+func itemSource(it Item) string {
+	if it.Source != "" {
+		return it.Source
+	}
+	for _, raw := range []string{it.URL, it.PDFURL} {
+		if u, err := url.Parse(raw); err == nil && u.Host != "" {
+			return strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+		}
+	}
+	return ""
+}
+
+func toAPIItem(it Item) apiItem {
+	return apiItem{ID: itemID(it), Item: it, Source: itemSource(it)}
+}
+
+// itemQuery: bộ lọc + sắp xếp của /api/items (và trang index).
+type itemQuery struct {
+	Q       string // tìm trong title, subject, tags (không phân biệt hoa thường)
+	Subject string // khớp subject chính hoặc một tag
+	Source  string
+	Sort    string // title (mặc định), subject, source; "-" phía trước = giảm dần
+
+	HideUnresolved bool // bỏ item pdf_status=unresolved
+}
+
+func parseItemQuery(v url.Values) itemQuery {
+	return itemQuery{
+		Q:       strings.TrimSpace(v.Get("q")),
+		Subject: strings.TrimSpace(v.Get("subject")),
+		Source:  strings.TrimSpace(v.Get("source")),
+		Sort:    strings.TrimSpace(v.Get("sort")),
+
+		HideUnresolved: v.Get("hide_unresolved") == "1" || v.Get("hide_unresolved") == "true",
+	}
+}
+
+func (q itemQuery) match(it Item) bool {
+	if q.HideUnresolved && it.PDFStatus == "unresolved" {
+		return false
+	}
+	if q.Source != "" && !strings.EqualFold(itemSource(it), q.Source) {
+		return false
+	}
+	if q.Subject != "" && !strings.EqualFold(it.Subject, q.Subject) && !containsFold(it.Tags, q.Subject) {
+		return false
+	}
+	if q.Q != "" {
+		needle := strings.ToLower(q.Q)
+		hay := strings.ToLower(it.Title + " " + it.Subject + " " + strings.Join(it.Tags, " "))
+		for _, w := range strings.Fields(needle) {
+			if !strings.Contains(hay, w) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+func containsFold(ss []string, s string) bool {
+	for _, x := range ss {
+		if strings.EqualFold(x, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// sortField: field sắp xếp (title, subject, source) và chiều; sort lạ = false.
+func (q itemQuery) sortField() (string, bool, bool) {
+	field, desc := q.Sort, false
+	if strings.HasPrefix(field, "-") {
+		field, desc = field[1:], true
+	}
+	if field == "" {
+		field = "title"
+	}
+	_, ok := sortKeys[field]
+	return field, desc, ok
+}
+
+// pageBounds: limit/offset từ query, đã kẹp vào [1, apiMaxLimit] và [0, total].
+func pageBounds(v url.Values, total int) (offset, limit int) {
+	limit = apiDefaultLimit
+	if n, err := strconv.Atoi(v.Get("limit")); err == nil && n > 0 {
+		limit = min(n, apiMaxLimit)
+	}
+	if n, err := strconv.Atoi(v.Get("offset")); err == nil && n > 0 {
+		offset = min(n, total)
+	}
+	return offset, limit
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+// handleAPIItems: GET /api/items?q=&subject=&source=&sort=&hide_unresolved=1&limit=&offset=
+func handleAPIItems(cat *Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		v := r.URL.Query()
+		view := cat.View()
+		items, ok := view.Query(parseItemQuery(v))
+		if !ok {
+			writeJSON(w, http.StatusBadRequest, map[string]string{"error": "sort must be title, subject or source (prefix - for descending)"})
+			return
+		}
+		offset, limit := pageBounds(v, len(items))
+		end := min(offset+limit, len(items))
+
+		page := make([]apiItem, 0, end-offset)
+		for _, it := range items[offset:end] {
+			page = append(page, toAPIItem(it))
+		}
+		resp := map[string]any{
+			"items":       page,
+			"total":       len(items),
+			"offset":      offset,
+			"limit":       limit,
+			"next_offset": nil,
+			"version":     view.version,
+		}
+		if end < len(items) {
+			resp["next_offset"] = end
+		}
+		writeJSON(w, http.StatusOK, resp)
+	}
+}
+
+// handleAPIItem: GET /api/items/{id}
+func handleAPIItem(cat *Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		it, ok := cat.View().Item(r.PathValue("id"))
+		if !ok {
+			writeJSON(w, http.StatusNotFound, map[string]string{"error": "item not found"})
+			return
+		}
+		writeJSON(w, http.StatusOK, toAPIItem(it))
+	}
+}
+
+// handleAPISubjects: GET /api/subjects[?source=] -> subject chính kèm số item.
+func handleAPISubjects(cat *Catalog) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		source := strings.TrimSpace(r.URL.Query().Get("source"))
+		writeJSON(w, http.StatusOK, map[string]any{"subjects": cat.View().Subjects(source)})
+	}
+}
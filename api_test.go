@@ -0,0 +1,201 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// apiTestItems: 5 item, 2 source (suy từ host và field source), một item unresolved.
+func apiTestItems() []Item {
+	return []Item{
+		{Title: "Easter addition", PDFURL: "https://worksheetfun.com/e.pdf", Source: "worksheetfun", Subject: "Math", Tags: []string{"Math"}},
+		{Title: "Counting to 10", PDFURL: "https://www.kiddoworksheets.com/c.pdf", Subject: "Math", Tags: []string{"Math", "Preschool"}},
+		{Title: "alphabet tracing", PDFURL: "https://www.kiddoworksheets.com/a.pdf", Subject: "English", Tags: []string{"English", "Preschool"}},
+		{Title: "Dinosaur maze", PDFURL: "https://worksheetfun.com/d.pdf", Source: "worksheetfun", Subject: "Puzzles", PDFStatus: "unresolved"},
+		{Title: "Bugs coloring", PDFURL: "https://www.kiddoworksheets.com/b.pdf", Subject: "Coloring"},
+	}
+}
+
+func newAPITestMux(cat *Catalog) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/items", handleAPIItems(cat))
+	mux.HandleFunc("GET /api/items/{id}", handleAPIItem(cat))
+	mux.HandleFunc("GET /api/subjects", handleAPISubjects(cat))
+	return mux
+}
+
+type apiItemsResp struct {
+	Items      []apiItem `json:"items"`
+	Total      int       `json:"total"`
+	Offset     int       `json:"offset"`
+	Limit      int       `json:"limit"`
+	NextOffset *int      `json:"next_offset"`
+	Version    int64     `json:"version"`
+}
+
+func apiGet(t *testing.T, h http.Handler, path string, out any) int {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, httptest.NewRequest("GET", path, nil))
+	if ct := rec.Header().Get("Content-Type"); ct != "application/json" {
+		t.Errorf("GET %s: Content-Type = %q", path, ct)
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), out); err != nil {
+		t.Fatalf("GET %s: %v\n%s", path, err, rec.Body)
+	}
+	return rec.Code
+}
+
+func apiTitles(items []apiItem) []string {
+	out := []string{}
+	for _, it := range items {
+		out = append(out, it.Title)
+	}
+	return out
+}
+
+func TestAPIItemsFilters(t *testing.T) {
+	mux := newAPITestMux(newCatalog(apiTestItems()))
+	const (
+		a = "alphabet tracing"
+		b = "Bugs coloring"
+		c = "Counting to 10"
+		d = "Dinosaur maze"
+		e = "Easter addition"
+	)
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{"", []string{a, b, c, d, e}}, // mặc định theo title, không phân biệt hoa thường
+		{"subject=math", []string{c, e}},
+		{"subject=preschool", []string{a, c}}, // khớp cả tag
+		{"subject=nope", []string{}},
+		{"q=COUNTING", []string{c}},
+		{"q=math+preschool", []string{c}}, // mọi từ đều phải khớp
+		{"source=worksheetfun", []string{d, e}},
+		{"source=kiddoworksheets.com", []string{a, b, c}}, // data cũ: source suy từ host
+		{"hide_unresolved=1", []string{a, b, c, e}},
+		{"sort=-title", []string{e, d, c, b, a}},
+		{"sort=subject", []string{b, a, c, e, d}},
+		{"sort=-source", []string{d, e, a, b, c}}, // cùng khoá thì giữ thứ tự title
+		{"subject=math&source=worksheetfun", []string{e}},
+		{"subject=math&sort=-title", []string{e, c}},
+	}
+	for _, tc := range tests {
+		var resp apiItemsResp
+		if code := apiGet(t, mux, "/api/items?"+tc.query, &resp); code != http.StatusOK {
+			t.Errorf("%s: status %d", tc.query, code)
+			continue
+		}
+		if got := apiTitles(resp.Items); !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("%s: titles = %q, want %q", tc.query, got, tc.want)
+		}
+		if resp.Total != len(tc.want) {
+			t.Errorf("%s: total = %d, want %d", tc.query, resp.Total, len(tc.want))
+		}
+	}
+
+	var resp apiItemsResp
+	if code := apiGet(t, mux, "/api/items?source=worksheetfun", &resp); code == http.StatusOK {
+		for _, it := range resp.Items {
+			if it.ID != itemID(it.Item) || it.Source != "worksheetfun" {
+				t.Errorf("item %q: id = %q source = %q", it.Title, it.ID, it.Source)
+			}
+		}
+	}
+
+	var bad map[string]string
+	if code := apiGet(t, mux, "/api/items?sort=bogus", &bad); code != http.StatusBadRequest || bad["error"] == "" {
+		t.Errorf("sort=bogus: %d %v, want 400 with error", code, bad)
+	}
+}
+
+func TestAPIItemsPagination(t *testing.T) {
+	mux := newAPITestMux(newCatalog(apiTestItems()))
+	next := func(n int) *int { return &n }
+	tests := []struct {
+		query      string
+		wantTitles int
+		wantOffset int
+		wantLimit  int
+		wantNext   *int
+	}{
+		{"", 5, 0, apiDefaultLimit, nil},
+		{"limit=2", 2, 0, 2, next(2)},
+		{"limit=2&offset=2", 2, 2, 2, next(4)},
+		{"limit=2&offset=4", 1, 4, 2, nil},
+		{"offset=99", 0, 5, apiDefaultLimit, nil}, // kẹp về total
+		{"limit=0&offset=-3", 5, 0, apiDefaultLimit, nil},
+		{"limit=100000", 5, 0, apiMaxLimit, nil},
+		{"hide_unresolved=1&limit=3&offset=3", 1, 3, 3, nil}, // phân trang sau khi lọc
+	}
+	for _, tc := range tests {
+		var resp apiItemsResp
+		apiGet(t, mux, "/api/items?"+tc.query, &resp)
+		if len(resp.Items) != tc.wantTitles || resp.Offset != tc.wantOffset || resp.Limit != tc.wantLimit {
+			t.Errorf("%s: %d items offset %d limit %d, want %d items offset %d limit %d",
+				tc.query, len(resp.Items), resp.Offset, resp.Limit, tc.wantTitles, tc.wantOffset, tc.wantLimit)
+		}
+		if !reflect.DeepEqual(resp.NextOffset, tc.wantNext) {
+			t.Errorf("%s: next_offset = %v, want %v", tc.query, resp.NextOffset, tc.wantNext)
+		}
+	}
+
+	// đi hết các trang theo next_offset: đủ item, không trùng
+	var seen []string
+	for off := 0; ; {
+		var resp apiItemsResp
+		apiGet(t, mux, "/api/items?limit=2&offset="+strconv.Itoa(off), &resp)
+		seen = append(seen, apiTitles(resp.Items)...)
+		if resp.NextOffset == nil {
+			break
+		}
+		off = *resp.NextOffset
+	}
+	var all apiItemsResp
+	apiGet(t, mux, "/api/items", &all)
+	if !reflect.DeepEqual(seen, apiTitles(all.Items)) {
+		t.Errorf("paged titles = %q, want %q", seen, apiTitles(all.Items))
+	}
+}
+
+func TestAPIItemAndSubjects(t *testing.T) {
+	items := apiTestItems()
+	cat := newCatalog(items)
+	mux := newAPITestMux(cat)
+
+	var got apiItem
+	if code := apiGet(t, mux, "/api/items/"+itemID(items[1]), &got); code != http.StatusOK {
+		t.Fatalf("GET item: status %d", code)
+	}
+	if got.Title != "Counting to 10" || got.ID != itemID(items[1]) || got.Source != "kiddoworksheets.com" {
+		t.Errorf("item = %+v", got)
+	}
+	var nf map[string]string
+	if code := apiGet(t, mux, "/api/items/0000000000000000", &nf); code != http.StatusNotFound || nf["error"] == "" {
+		t.Errorf("unknown id: %d %v, want 404 with error", code, nf)
+	}
+
+	tests := []struct {
+		query string
+		want  []subjectCount
+	}{
+		{"", []subjectCount{{"Math", 2}, {"Coloring", 1}, {"English", 1}, {"Puzzles", 1}}},
+		{"?source=WorksheetFun", []subjectCount{{"Math", 1}, {"Puzzles", 1}}},
+		{"?source=nope", []subjectCount{}},
+	}
+	for _, tc := range tests {
+		var resp struct {
+			Subjects []subjectCount `json:"subjects"`
+		}
+		apiGet(t, mux, "/api/subjects"+tc.query, &resp)
+		if !reflect.DeepEqual(resp.Subjects, tc.want) {
+			t.Errorf("subjects%s = %v, want %v", tc.query, resp.Subjects, tc.want)
+		}
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Catalog: catalog UI/API đang phục vụ. Mỗi lần nạp dựng một catalogView
+// bất biến (đã sort theo title, có index theo id/subject/source) rồi thay
+// con trỏ một lần; request chỉ đọc view nên không cần khoá và không ai sort
+// lại slice dùng chung.
+type Catalog struct {
+	mu   sync.Mutex // chỉ để các lần Replace không chen nhau
+	view atomic.Pointer[catalogView]
+}
+
+func newCatalog(items []Item) *Catalog {
+	c := &Catalog{}
+	c.view.Store(buildCatalogView(items, 0))
+	return c
+}
+
+// View trả snapshot hiện tại; một request nên lấy một lần rồi dùng xuyên suốt.
+func (c *Catalog) View() *catalogView { return c.view.Load() }
+
+// Replace dựng view mới từ items (version tăng 1) và thay nguyên tử.
+func (c *Catalog) Replace(items []Item) *catalogView {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	v := buildCatalogView(items, c.View().version+1)
+	c.view.Store(v)
+	return v
+}
+
+type subjectCount struct {
+	Subject string `json:"subject"`
+	Count   int    `json:"count"`
+}
+
+// catalogView: snapshot chỉ đọc, không được sửa sau khi dựng.
+type catalogView struct {
+	version  int64
+	loadedAt time.Time
+
+	items     []Item           // sort theo title (không phân biệt hoa thường)
+	byID      map[string]int   // itemID -> vị trí trong items
+	bySubject map[string][]int // lower(subject hoặc tag) -> vị trí, theo thứ tự title
+	bySource  map[string][]int // lower(itemSource) -> vị trí, theo thứ tự title
+	images    map[string]bool  // img_url có trong catalog (cho /thumb)
+	labels    []string         // subject + tag cho dropdown, A-Z
+	subjects  []subjectCount   // subject chính kèm số item, nhiều nhất trước
+}
+
+func buildCatalogView(items []Item, version int64) *catalogView {
+	sorted := uniqueByPDFURL(items)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return strings.ToLower(sorted[i].Title) < strings.ToLower(sorted[j].Title)
+	})
+
+	v := &catalogView{
+		version:   version,
+		loadedAt:  time.Now(),
+		items:     sorted,
+		byID:      make(map[string]int, len(sorted)),
+		bySubject: map[string][]int{},
+		bySource:  map[string][]int{},
+		images:    make(map[string]bool, len(sorted)),
+	}
+	labelSeen := map[string]bool{}
+	for i, it := range sorted {
+		v.byID[itemID(it)] = i
+		if src := strings.ToLower(itemSource(it)); src != "" {
+			v.bySource[src] = append(v.bySource[src], i)
+		}
+		keys := map[string]bool{}
+		for _, s := range append([]string{it.Subject}, it.Tags...) {
+			k := strings.ToLower(s)
+			if s == "" || keys[k] {
+				continue
+			}
+			keys[k] = true
+			v.bySubject[k] = append(v.bySubject[k], i)
+			if !labelSeen[k] {
+				labelSeen[k] = true
+				v.labels = append(v.labels, s)
+			}
+		}
+		if it.IMGURL != "" {
+			v.images[it.IMGURL] = true
+		}
+	}
+	sort.Slice(v.labels, func(i, j int) bool { return strings.ToLower(v.labels[i]) < strings.ToLower(v.labels[j]) })
+	v.subjects = countSubjects(sorted, nil)
+	return v
+}
+
+// uniqueByPDFURL: bản sao của items, mỗi pdf_url một item vì itemID băm
+// pdf_url. Item trùng (sửa tay, cùng PDF từ hai trang) gộp vào item gặp
+// trước bằng mergeDuplicate; item không có pdf_url bị bỏ như lúc store đọc.
+func uniqueByPDFURL(items []Item) []Item {
+	out := make([]Item, 0, len(items))
+	pos := make(map[string]int, len(items))
+	for _, it := range items {
+		k := itemKey(it)
+		if k == "" {
+			continue
+		}
+		if i, ok := pos[k]; ok {
+			out[i] = mergeDuplicate(out[i], it)
+			continue
+		}
+		pos[k] = len(out)
+		out = append(out, it)
+	}
+	return out
+}
+
+// countSubjects đếm subject chính trên items (idx != nil: chỉ các vị trí đó).
+func countSubjects(items []Item, idx []int) []subjectCount {
+	counts := map[string]int{}
+	add := func(it Item) {
+		if it.Subject != "" {
+			counts[it.Subject]++
+		}
+	}
+	if idx == nil {
+		for _, it := range items {
+			add(it)
+		}
+	} else {
+		for _, i := range idx {
+			add(items[i])
+		}
+	}
+	out := make([]subjectCount, 0, len(counts))
+	for s, n := range counts {
+		out = append(out, subjectCount{s, n})
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Count != out[j].Count {
+			return out[i].Count > out[j].Count
+		}
+		return out[i].Subject < out[j].Subject
+	})
+	return out
+}
+
+func (v *catalogView) Len() int { return len(v.items) }
+
+// Items: mọi item theo title; chỉ đọc.
+func (v *catalogView) Items() []Item { return v.items }
+
+func (v *catalogView) Item(id string) (Item, bool) {
+	i, ok := v.byID[id]
+	if !ok {
+		return Item{}, false
+	}
+	return v.items[i], true
+}
+
+func (v *catalogView) HasImage(u string) bool { return v.images[u] }
+
+// Labels: subject + tag của cả catalog (bỏ trùng không phân biệt hoa thường), A-Z.
+func (v *catalogView) Labels() []string { return v.labels }
+
+// Subjects: subject chính kèm số item; source != "" thì chỉ đếm item của source đó.
+func (v *catalogView) Subjects(source string) []subjectCount {
+	if source == "" {
+		return v.subjects
+	}
+	idx := v.bySource[strings.ToLower(source)]
+	if len(idx) == 0 {
+		return []subjectCount{}
+	}
+	return countSubjects(v.items, idx)
+}
+
+// Query lọc + sắp xếp ra slice mới; subject/source đi qua index thay vì
+// duyệt cả catalog. false = sort không hợp lệ.
+func (v *catalogView) Query(q itemQuery) ([]Item, bool) {
+	field, desc, ok := q.sortField()
+	if !ok {
+		return nil, false
+	}
+
+	var cand []int // nil = cả catalog
+	if q.Subject != "" {
+		cand = v.bySubject[strings.ToLower(q.Subject)]
+		if cand == nil {
+			cand = []int{}
+		}
+	}
+	if q.Source != "" {
+		bySrc := v.bySource[strings.ToLower(q.Source)]
+		if bySrc == nil {
+			bySrc = []int{}
+		}
+		if cand == nil || len(bySrc) < len(cand) {
+			cand = bySrc
+		}
+	}
+
+	var out []Item
+	if cand == nil {
+		out = make([]Item, 0, len(v.items))
+		for _, it := range v.items {
+			if q.match(it) {
+				out = append(out, it)
+			}
+		}
+	} else {
+		out = make([]Item, 0, len(cand))
+		for _, i := range cand {
+			if q.match(v.items[i]) {
+				out = append(out, v.items[i])
+			}
+		}
+	}
+
+	// out đã theo title; sort ổn định theo khoá khác giữ title làm thứ tự phụ
+	switch {
+	case field == "title" && desc:
+		for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+			out[i], out[j] = out[j], out[i]
+		}
+	case field != "title":
+		key := sortKeys[field]
+		sort.SliceStable(out, func(i, j int) bool {
+			ki, kj := key(out[i]), key(out[j])
+			if desc {
+				return ki > kj
+			}
+			return ki < kj
+		})
+	}
+	return out, true
+}
+
+var sortKeys = map[string]func(Item) string{
+	"title":   func(it Item) string { return strings.ToLower(it.Title) },
+	"subject": func(it Item) string { return strings.ToLower(it.Subject) },
+	"source":  itemSource,
+}
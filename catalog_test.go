@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"net/http/httptest"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+func catalogTestItems(n int) []Item {
+	items := make([]Item, n)
+	for i := range items {
+		items[i] = Item{Title: fmt.Sprintf("Sheet %03d", (i*37)%n), PDFURL: fmt.Sprintf("https://x/%d.pdf", i), Subject: "Math"}
+	}
+	return items
+}
+
+// Replace thay cả view một lần: view cũ đang được đọc không đổi, view mới
+// có version tăng và đã sort.
+func TestCatalogReplace(t *testing.T) {
+	in := catalogTestItems(3)
+	cat := newCatalog(in)
+	old := cat.View()
+	if old.version != 0 || old.Len() != 3 {
+		t.Fatalf("initial view: version %d len %d", old.version, old.Len())
+	}
+	in[0].Title = "changed" // catalog giữ bản sao, không dùng chung slice
+	if it, _ := old.Item(itemID(in[0])); it.Title == "changed" {
+		t.Error("catalog shares the caller's slice")
+	}
+
+	nv := cat.Replace(catalogTestItems(5))
+	if cat.View() != nv || nv.version != 1 || nv.Len() != 5 {
+		t.Errorf("after Replace: view %p (want %p) version %d len %d", cat.View(), nv, nv.version, nv.Len())
+	}
+	if old.version != 0 || old.Len() != 3 {
+		t.Errorf("old view changed: version %d len %d", old.version, old.Len())
+	}
+	for i, it := range nv.Items() {
+		if want := fmt.Sprintf("Sheet %03d", i); it.Title != want {
+			t.Errorf("items[%d] = %q, want %q", i, it.Title, want)
+		}
+	}
+	if cat.Replace(nil).version != 2 || cat.View().Len() != 0 {
+		t.Errorf("Replace(nil): version %d len %d", cat.View().version, cat.View().Len())
+	}
+}
+
+// Request đang chạy khi catalog bị thay vẫn thấy một view nhất quán:
+// total luôn khớp version đã trả về. Chạy với -race để bắt data race.
+func TestCatalogReplaceConcurrentReads(t *testing.T) {
+	const base = 50
+	cat := newCatalog(catalogTestItems(base))
+	mux := newAPITestMux(cat)
+	index := handleIndex(cat, t.TempDir(), false)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				var resp apiItemsResp
+				apiGet(t, mux, "/api/items?subject=math&sort=-title&limit=10", &resp)
+				if resp.Total != base+int(resp.Version) {
+					t.Errorf("version %d: total %d, want %d", resp.Version, resp.Total, base+int(resp.Version))
+					return
+				}
+				rec := httptest.NewRecorder()
+				index(rec, httptest.NewRequest("GET", "/?page=2&per=7", nil))
+				if rec.Code != 200 {
+					t.Errorf("index: status %d", rec.Code)
+					return
+				}
+			}
+		}()
+	}
+	for v := 1; v <= 30; v++ {
+		cat.Replace(catalogTestItems(base + v))
+	}
+	wg.Wait()
+	if got := cat.View().version; got != 30 {
+		t.Errorf("version = %d, want 30", got)
+	}
+}
+
+// itemID băm pdf_url: item trùng pdf_url gộp làm một khi nạp, không để hai
+// item cùng id (cái sau không bao giờ lấy được qua /api/items/{id}).
+func TestCatalogUniquePDFURL(t *testing.T) {
+	cat := newCatalog([]Item{
+		{Title: "Farm animals", PDFURL: "https://x/farm.pdf", URL: "https://x/farm/", Subject: "Coloring", Tags: []string{"Coloring"}},
+		{Title: "No PDF", URL: "https://x/none/"},
+		{Title: "Farm animals 2", PDFURL: " https://x/farm.pdf", URL: "https://x/farm-2/", IMGURL: "https://x/farm.png", Tags: []string{"Preschool"}, Aliases: []string{"https://x/farm-old.pdf"}},
+		{Title: "Apples", PDFURL: "https://x/apples.pdf", Subject: "Math"},
+	})
+	v := cat.View()
+	if v.Len() != 2 || len(v.byID) != v.Len() {
+		t.Fatalf("catalog has %d items, %d ids; want 2 and 2: %+v", v.Len(), len(v.byID), v.Items())
+	}
+	it, ok := v.Item(itemID(Item{PDFURL: "https://x/farm.pdf"}))
+	if !ok {
+		t.Fatal("merged item not found by id")
+	}
+	if it.Title != "Farm animals" || it.URL != "https://x/farm/" || it.IMGURL != "https://x/farm.png" ||
+		!reflect.DeepEqual(it.Tags, []string{"Coloring", "Preschool"}) || !reflect.DeepEqual(it.Aliases, []string{"https://x/farm-old.pdf"}) {
+		t.Errorf("merged item = %+v", it)
+	}
+	if got := v.Subjects(""); !reflect.DeepEqual(got, []subjectCount{{"Coloring", 1}, {"Math", 1}}) {
+		t.Errorf("subjects = %v, duplicate counted twice", got)
+	}
+}
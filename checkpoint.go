@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"os"
+	"slices"
+	"time"
+)
+
+// checkpoint: trạng thái crawl của một source.
+// File cũ chỉ có {"last_page":N} vẫn đọc được: các trường mới để trống.
+type checkpoint struct {
+	LastPage      int                      `json:"last_page"`            // đã crawl xong tới trang này
+	DonePages     []int                    `json:"done_pages,omitempty"` // các trang list đã xử lý xong
+	FailedPages   map[int]*crawlFailure    `json:"failed_pages,omitempty"`
+	FailedDetails map[string]*crawlFailure `json:"failed_details,omitempty"`
+
+	// SitemapLastmod: detail URL -> <lastmod> lần cuối xử lý (Discovery = "sitemap")
+	SitemapLastmod map[string]string `json:"sitemap_lastmod,omitempty"`
+}
+
+// crawlFailure: một trang list hoặc detail URL lỗi, chờ retry ở lần chạy sau.
+type crawlFailure struct {
+	Error    string    `json:"error"`
+	Attempts int       `json:"attempts"`
+	Page     int       `json:"page,omitempty"` // trang list chứa detail URL
+	LastTry  time.Time `json:"last_try"`
+}
+
+func (cp *checkpoint) donePage(p int) {
+	delete(cp.FailedPages, p)
+	if i, ok := slices.BinarySearch(cp.DonePages, p); !ok {
+		cp.DonePages = slices.Insert(cp.DonePages, i, p)
+	}
+}
+
+func (cp *checkpoint) failPage(p int, err error) {
+	if cp.FailedPages == nil {
+		cp.FailedPages = map[int]*crawlFailure{}
+	}
+	f := cp.FailedPages[p]
+	if f == nil {
+		f = &crawlFailure{}
+		cp.FailedPages[p] = f
+	}
+	f.Error, f.LastTry = err.Error(), time.Now()
+	f.Attempts++
+}
+
+func (cp *checkpoint) doneDetail(u string) {
+	delete(cp.FailedDetails, u)
+}
+
+// failDetail: page = 0 giữ nguyên trang đã ghi trước đó (retry pass).
+func (cp *checkpoint) failDetail(u string, page int, err error) {
+	if cp.FailedDetails == nil {
+		cp.FailedDetails = map[string]*crawlFailure{}
+	}
+	f := cp.FailedDetails[u]
+	if f == nil {
+		f = &crawlFailure{}
+		cp.FailedDetails[u] = f
+	}
+	if page > 0 {
+		f.Page = page
+	}
+	f.Error, f.LastTry = err.Error(), time.Now()
+	f.Attempts++
+}
+
+// ---- checkpoint I/O ----
+
+func readCheckpoint(path string) (checkpoint, error) {
+	var cp checkpoint
+	f, err := os.Open(path)
+	if err != nil {
+		return cp, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&cp); err != nil {
+		return cp, err
+	}
+	return cp, nil
+}
+
+func writeCheckpoint(path string, cp *checkpoint) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(cp); err != nil {
+		f.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// Checkpoint cũ chỉ có last_page vẫn đọc được, các trường mới để trống.
+func TestReadCheckpointLegacy(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "kiddo.checkpoint.json")
+	if err := os.WriteFile(path, []byte(`{"last_page":121}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cp, err := readCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := checkpoint{LastPage: 121}
+	if !reflect.DeepEqual(cp, want) {
+		t.Errorf("checkpoint = %+v, want %+v", cp, want)
+	}
+
+	// file mới ghi lại vẫn giữ last_page cho bản cũ đọc
+	if err := writeCheckpoint(path, &cp); err != nil {
+		t.Fatal(err)
+	}
+	if b, _ := os.ReadFile(path); string(b) != "{\n  \"last_page\": 121\n}\n" {
+		t.Errorf("rewritten legacy checkpoint = %s", b)
+	}
+}
+
+func TestCheckpointFailuresRoundTrip(t *testing.T) {
+	var cp checkpoint
+	cp.LastPage = 3
+	cp.donePage(3)
+	cp.donePage(1)
+	cp.donePage(3)
+	cp.failPage(2, errors.New("http 503"))
+	cp.failPage(2, errors.New("timeout"))
+	cp.failPage(4, errors.New("http 500"))
+	cp.donePage(4) // retry thành công -> bỏ khỏi failed
+	cp.failDetail("https://x/d/a", 1, errors.New("http 404"))
+	cp.failDetail("https://x/d/a", 0, errors.New("http 502")) // retry pass giữ trang cũ
+	cp.failDetail("https://x/d/b", 2, errors.New("reset"))
+	cp.doneDetail("https://x/d/b")
+	cp.SitemapLastmod = map[string]string{"https://x/d/c": "2024-01-01"}
+
+	path := filepath.Join(t.TempDir(), "cp.json")
+	if err := writeCheckpoint(path, &cp); err != nil {
+		t.Fatal(err)
+	}
+	got, err := readCheckpoint(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []int{1, 3, 4}; !reflect.DeepEqual(got.DonePages, want) {
+		t.Errorf("done pages = %v, want %v", got.DonePages, want)
+	}
+	if len(got.FailedPages) != 1 || got.FailedPages[2] == nil {
+		t.Fatalf("failed pages = %+v, want only page 2", got.FailedPages)
+	}
+	if f := got.FailedPages[2]; f.Attempts != 2 || f.Error != "timeout" || f.LastTry.IsZero() {
+		t.Errorf("failed page 2 = %+v, want 2 attempts, last error timeout", f)
+	}
+	if len(got.FailedDetails) != 1 || got.FailedDetails["https://x/d/a"] == nil {
+		t.Fatalf("failed details = %+v, want only /d/a", got.FailedDetails)
+	}
+	if f := got.FailedDetails["https://x/d/a"]; f.Attempts != 2 || f.Page != 1 || f.Error != "http 502" {
+		t.Errorf("failed detail = %+v, want 2 attempts on page 1, last error http 502", f)
+	}
+	if got.LastPage != 3 || got.SitemapLastmod["https://x/d/c"] != "2024-01-01" {
+		t.Errorf("checkpoint = %+v", got)
+	}
+	if !got.FailedPages[2].LastTry.Equal(cp.FailedPages[2].LastTry) {
+		t.Errorf("last_try = %v, want %v", got.FailedPages[2].LastTry, cp.FailedPages[2].LastTry)
+	}
+}
@@ -3,43 +3,258 @@ package main
 import (
 	"bufio"
 	"encoding/json"
+	"fmt"
+	"io"
 	"os"
+	"path/filepath"
+	"sort"
 	"strings"
 )
 
+// ItemStore: nơi lưu catalog. Crawler Append từng batch, -migrate_subjects
+// Upsert các item đổi theo pdf_url, UI và các lệnh batch Load/Iterate.
+// resolve/verify/dedup đổi chính pdf_url (khoá) hoặc ghi ra file khác nên
+// ghi lại cả file bằng writeItemsAtomic.
+// Không an toàn khi nhiều goroutine cùng ghi; mỗi tiến trình ghi một store.
+type ItemStore interface {
+	Load() ([]Item, error)             // toàn bộ item theo thứ tự lưu
+	Append(items ...Item) error        // thêm cuối (caller tự dedup)
+	Upsert(items ...Item) error        // thay item cùng pdf_url, chưa có thì thêm cuối
+	Iterate(fn func(Item) error) error // duyệt tuần tự, fn trả lỗi thì dừng
+	Close() error
+}
+
+// storeFormat: -store ghi đè định dạng; "" = đoán theo đuôi file.
+var storeFormat string
+
+// itemStoreKind: jsonl (.jsonl), kv (.db, xem kvstore.go) hoặc json (JSON array, mặc định).
+func itemStoreKind(path string) string {
+	if storeFormat != "" {
+		return storeFormat
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".jsonl":
+		return "jsonl"
+	case ".db":
+		return "kv"
+	default:
+		return "json"
+	}
+}
+
+// openItemStore mở store cho path theo itemStoreKind; file chưa có = store rỗng.
+func openItemStore(path string) (ItemStore, error) {
+	switch kind := itemStoreKind(path); kind {
+	case "jsonl":
+		return &jsonlStore{path: path}, nil
+	case "json":
+		return &jsonArrayStore{path: path}, nil
+	case "kv":
+		return openKVStore(path)
+	default:
+		return nil, fmt.Errorf("unknown item store %q (want jsonl, json or kv)", kind)
+	}
+}
+
+// loadItems đọc cả catalog; file chưa có là lỗi như trước (caller tự bỏ qua khi cần).
 func loadItems(path string) ([]Item, error) {
-	f, err := os.Open(path)
+	if _, err := os.Stat(path); err != nil {
+		return nil, err
+	}
+	st, err := openItemStore(path)
 	if err != nil {
 		return nil, err
 	}
+	defer st.Close()
+	return st.Load()
+}
+
+// writeItemsAtomic: ghi lại cả file data theo định dạng của store.
+func writeItemsAtomic(path string, items []Item) error {
+	tmp := path + ".tmp"
+	var write func(string, []Item) error
+	switch kind := itemStoreKind(path); kind {
+	case "jsonl":
+		write = writeJSONL
+	case "json":
+		write = writeJSONArray
+	case "kv":
+		write = writeKV
+	default:
+		return fmt.Errorf("unknown item store %q (want jsonl, json or kv)", kind)
+	}
+	if err := write(tmp, items); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+func itemKey(it Item) string { return strings.TrimSpace(it.PDFURL) }
+
+// upsertSlice: thay theo pdf_url, giữ vị trí cũ; item mới thêm cuối.
+func upsertSlice(existing, items []Item) []Item {
+	pos := make(map[string]int, len(existing))
+	for i, it := range existing {
+		pos[itemKey(it)] = i
+	}
+	for _, it := range items {
+		if i, ok := pos[itemKey(it)]; ok {
+			existing[i] = it
+			continue
+		}
+		pos[itemKey(it)] = len(existing)
+		existing = append(existing, it)
+	}
+	return existing
+}
+
+func iterateSlice(items []Item, err error, fn func(Item) error) error {
+	if err != nil {
+		return err
+	}
+	for _, it := range items {
+		if err := fn(it); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ---- JSONL: mỗi dòng một item, append không phải đọc lại file ----
+
+type jsonlStore struct {
+	path string
+}
+
+func (s *jsonlStore) Load() ([]Item, error) {
+	var items []Item
+	err := s.Iterate(func(it Item) error {
+		items = append(items, it)
+		return nil
+	})
+	return items, err
+}
+
+func (s *jsonlStore) Iterate(fn func(Item) error) error {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
 	defer f.Close()
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16<<20)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		var it Item
+		if err := json.Unmarshal([]byte(line), &it); err != nil {
+			return err
+		}
+		// basic validation
+		if it.PDFURL == "" {
+			continue
+		}
+		if err := fn(it); err != nil {
+			return err
+		}
+	}
+	return sc.Err()
+}
 
-	// detect jsonl vs json array
-	if strings.HasSuffix(strings.ToLower(path), ".jsonl") {
-		var items []Item
-		sc := bufio.NewScanner(f)
-		for sc.Scan() {
-			line := strings.TrimSpace(sc.Text())
-			if line == "" {
-				continue
-			}
-			var it Item
-			if err := json.Unmarshal([]byte(line), &it); err != nil {
-				return nil, err
-			}
-			// basic validation
-			if it.PDFURL == "" {
-				continue
-			}
-			items = append(items, it)
+func (s *jsonlStore) Append(items ...Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, it := range items {
+		if err := enc.Encode(it); err != nil {
+			return err
 		}
-		return items, sc.Err()
 	}
+	return w.Flush()
+}
+
+func (s *jsonlStore) Upsert(items ...Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	existing, err := s.Load()
+	if err != nil {
+		return err
+	}
+	return writeItemsAtomic(s.path, upsertSlice(existing, items))
+}
 
-	// else treat as JSON array
+func (s *jsonlStore) Close() error { return nil }
+
+// ---- JSON array: file được sort theo title cho ổn định; mỗi lần ghi nạp
+// lại cả mảng và ghi qua file tạm + rename (crash giữa chừng không hỏng file) ----
+
+type jsonArrayStore struct {
+	path string
+}
+
+func (s *jsonArrayStore) Load() ([]Item, error) {
+	f, err := os.Open(s.path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
 	var items []Item
-	if err := json.NewDecoder(f).Decode(&items); err != nil {
+	if err := json.NewDecoder(f).Decode(&items); err != nil && err != io.EOF {
 		return nil, err
 	}
 	return items, nil
 }
+
+func (s *jsonArrayStore) Iterate(fn func(Item) error) error {
+	items, err := s.Load()
+	return iterateSlice(items, err, fn)
+}
+
+func (s *jsonArrayStore) Append(items ...Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	existing, err := s.Load()
+	if err != nil {
+		return err
+	}
+	return s.write(append(existing, items...))
+}
+
+func (s *jsonArrayStore) Upsert(items ...Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	existing, err := s.Load()
+	if err != nil {
+		return err
+	}
+	return s.write(upsertSlice(existing, items))
+}
+
+// write sort theo title (không phân biệt hoa thường) rồi ghi lại cả file.
+func (s *jsonArrayStore) write(items []Item) error {
+	sort.SliceStable(items, func(i, j int) bool {
+		return strings.ToLower(items[i].Title) < strings.ToLower(items[j].Title)
+	})
+	return writeItemsAtomic(s.path, items)
+}
+
+func (s *jsonArrayStore) Close() error { return nil }
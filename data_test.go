@@ -0,0 +1,49 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// JSON array store: Append giữ file sort theo title và ghi qua file tạm.
+func TestJSONArrayStoreAppendSorted(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "items.json")
+	st, err := openItemStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Append(Item{Title: "cats", PDFURL: "u1"}, Item{Title: "Apples", PDFURL: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Append(Item{Title: "bears", PDFURL: "u3"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Upsert(Item{Title: "Zebras", PDFURL: "u2"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := st.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := loadItems(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var titles []string
+	for _, it := range got {
+		titles = append(titles, it.Title)
+	}
+	want := []string{"bears", "cats", "Zebras"}
+	if len(titles) != len(want) {
+		t.Fatalf("titles = %v, want %v", titles, want)
+	}
+	for i := range want {
+		if titles[i] != want[i] {
+			t.Fatalf("titles = %v, want %v", titles, want)
+		}
+	}
+	if _, err := os.Stat(path + ".tmp"); !os.IsNotExist(err) {
+		t.Errorf("temp file left behind: %v", err)
+	}
+}
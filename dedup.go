@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DedupByContent: gộp item từ nhiều file data (ví dụ kiddo + wsfun), tải mỗi
+// pdf_url một lần như /merge sẽ tải (downloadPDFWith), tính SHA-256 của file
+// rồi gộp các item cùng nội dung. Item đứng trước giữ lại, pdf_url của bản
+// trùng vào Aliases; tags gộp, field trống được bù từ bản trùng.
+// Item đã có sha256 (lần chạy trước) không tải lại; tải lỗi thì giữ nguyên.
+// m != nil: URL đã có trong mirror lấy hash từ đó, URL mới được tải vào mirror.
+func DedupByContent(inPaths []string, outPath string, m *pdfMirror, cfg CrawlConfig) error {
+	var items []Item
+	for _, p := range inPaths {
+		its, err := loadItems(p)
+		if err != nil {
+			return err
+		}
+		log.Printf("[dedup] %s: %d items", p, len(its))
+		items = append(items, its...)
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	client, _ := newCrawlClient(cfg)
+
+	tmpDir, err := osMkdirTemp("", "dedup_dl_*")
+	if err != nil {
+		return err
+	}
+	defer osRemoveAll(tmpDir)
+
+	// hash theo pdf_url, mỗi URL tải một lần
+	hashes := map[string]string{}
+	var todo []string
+	mirrored := 0
+	for _, it := range items {
+		u := strings.TrimSpace(it.PDFURL)
+		if it.SHA256 != "" {
+			hashes[u] = it.SHA256
+			continue
+		}
+		if _, queued := hashes[u]; queued {
+			continue
+		}
+		if m != nil {
+			if _, sum, ok := m.Lookup(u); ok {
+				hashes[u] = sum
+				mirrored++
+				continue
+			}
+		}
+		hashes[u] = ""
+		todo = append(todo, u)
+	}
+	log.Printf("[dedup] %d items, %d PDFs from mirror, %d PDFs to hash", len(items), mirrored, len(todo))
+
+	var mu sync.Mutex
+	failed := 0
+	_ = forEachParallel(context.Background(), len(todo), cfg.Workers, func(i int) {
+		var sum string
+		var err error
+		if m != nil {
+			_, sum, err = m.Fetch(client, todo[i])
+		} else {
+			sum, err = hashPDF(client, todo[i], filepath.Join(tmpDir, "f_"+strconv.Itoa(i)+".pdf"))
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			log.Printf("  [dedup] %s -> %v", todo[i], err)
+			failed++
+			return
+		}
+		hashes[todo[i]] = sum
+	})
+
+	var out []Item
+	byHash := map[string]int{} // sha256 -> index trong out
+	byURL := map[string]int{}  // pdf_url -> index trong out
+	dups := 0
+	for _, it := range items {
+		u := strings.TrimSpace(it.PDFURL)
+		if k, ok := byURL[u]; ok {
+			// cùng pdf_url xuất hiện ở nhiều file (cat kiddo + wsfun): gộp
+			// tags/aliases/ảnh/subject như bản trùng nội dung
+			out[k] = mergeDuplicate(out[k], it)
+			dups++
+			continue
+		}
+		it.SHA256 = hashes[u]
+		if k, ok := byHash[it.SHA256]; ok && it.SHA256 != "" {
+			out[k] = mergeDuplicate(out[k], it)
+			byURL[u] = k
+			dups++
+			continue
+		}
+		if it.SHA256 != "" {
+			byHash[it.SHA256] = len(out)
+		}
+		byURL[u] = len(out)
+		out = append(out, it)
+	}
+	log.Printf("[dedup] %d -> %d items (%d duplicates collapsed, %d downloads failed) -> %s", len(items), len(out), dups, failed, outPath)
+	if m != nil {
+		for _, it := range out {
+			mirrorLinkAliases(m, it, it.SHA256)
+		}
+		if err := m.Save(); err != nil {
+			return err
+		}
+	}
+	return writeItemsAtomic(outPath, out)
+}
+
+// mergeDuplicate gộp dup vào keep (cùng nội dung PDF, hoặc cùng pdf_url).
+func mergeDuplicate(keep, dup Item) Item {
+	var aliases []string
+	for _, a := range append(append(keep.Aliases, dup.PDFURL), dup.Aliases...) {
+		if a = strings.TrimSpace(a); a != "" && a != itemKey(keep) {
+			aliases = append(aliases, a)
+		}
+	}
+	keep.Aliases = uniq(aliases)
+	keep.Tags = normalizeTags(append(keep.Tags, dup.Tags...))
+	if keep.IMGURL == "" {
+		keep.IMGURL = dup.IMGURL
+	}
+	if keep.Subject == "" {
+		keep.Subject = dup.Subject
+	}
+	if keep.URL == "" {
+		keep.URL = dup.URL
+	}
+	return keep
+}
+
+// hashPDF tải u về tmp (theo luật của downloadPDF) và trả sha256 hex.
+func hashPDF(client Fetcher, u, tmp string) (string, error) {
+	defer os.Remove(tmp)
+	if err := downloadPDFWith(client, u, tmp); err != nil {
+		return "", err
+	}
+	return fileSHA256(tmp)
+}
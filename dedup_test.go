@@ -0,0 +1,87 @@
+package main
+
+import (
+	"net/http"
+	"path/filepath"
+	"testing"
+)
+
+// URL đã có trong mirror thì lấy hash từ đó, không tải lại.
+func TestDedupByContentUsesMirror(t *testing.T) {
+	pdf := scriptStep{status: 200, contentType: "application/pdf", body: "%PDF-1.4 same"}
+	srv := newScriptServer(t, map[string][]scriptStep{"/a.pdf": {pdf}, "/b.pdf": {pdf}, "/c.pdf": {pdf}})
+
+	dir := t.TempDir()
+	m, err := openMirror(filepath.Join(dir, "mirror"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{"/a.pdf", "/b.pdf"} {
+		if _, _, err := m.Fetch(http.DefaultClient, srv.URL+p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	in := filepath.Join(dir, "in.jsonl")
+	items := []Item{
+		{Title: "A", PDFURL: srv.URL + "/a.pdf"},
+		{Title: "B", PDFURL: srv.URL + "/b.pdf"},
+		{Title: "C", PDFURL: srv.URL + "/c.pdf"},
+	}
+	if err := writeItemsAtomic(in, items); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.jsonl")
+	if err := DedupByContent([]string{in}, out, m, CrawlConfig{Workers: 2}); err != nil {
+		t.Fatal(err)
+	}
+
+	for p, want := range map[string]int{"/a.pdf": 1, "/b.pdf": 1, "/c.pdf": 1} {
+		if got := srv.count(p); got != want {
+			t.Errorf("hits %s = %d, want %d", p, got, want)
+		}
+	}
+	got, err := loadItems(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || len(got[0].Aliases) != 2 || got[0].SHA256 == "" {
+		t.Fatalf("items = %+v, want one item with 2 aliases and a sha256", got)
+	}
+}
+
+// Cùng pdf_url ở hai file (kiddo + wsfun): bản sau gộp vào bản đầu, không mất
+// tags/ảnh/subject/aliases.
+func TestDedupByContentMergesSamePDFURL(t *testing.T) {
+	srv := newScriptServer(t, map[string][]scriptStep{"/a.pdf": {{status: 200, contentType: "application/pdf", body: "%PDF-1.4 a"}}})
+	dir := t.TempDir()
+	kiddo := filepath.Join(dir, "kiddo.jsonl")
+	wsfun := filepath.Join(dir, "wsfun.jsonl")
+	u := srv.URL + "/a.pdf"
+	if err := writeItemsAtomic(kiddo, []Item{{Title: "A", PDFURL: u, Tags: []string{"Math"}}}); err != nil {
+		t.Fatal(err)
+	}
+	second := Item{Title: "A (wsfun)", PDFURL: u, IMGURL: "https://x/a.png", Subject: "Math", Tags: []string{"Counting"}, Aliases: []string{"https://x/a-old.pdf"}}
+	if err := writeItemsAtomic(wsfun, []Item{second}); err != nil {
+		t.Fatal(err)
+	}
+	out := filepath.Join(dir, "out.jsonl")
+	if err := DedupByContent([]string{kiddo, wsfun}, out, nil, CrawlConfig{Workers: 1}); err != nil {
+		t.Fatal(err)
+	}
+	got, err := loadItems(out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 {
+		t.Fatalf("got %d items, want 1: %+v", len(got), got)
+	}
+	it := got[0]
+	if it.Title != "A" || it.IMGURL != second.IMGURL || it.Subject != "Math" || len(it.Tags) != 2 ||
+		len(it.Aliases) != 1 || it.Aliases[0] != "https://x/a-old.pdf" {
+		t.Errorf("merged item = %+v", it)
+	}
+	if got := srv.count("/a.pdf"); got != 1 {
+		t.Errorf("hits = %d, want 1", got)
+	}
+}
@@ -14,19 +14,40 @@ import (
 	"github.com/PuerkitoBio/goquery"
 )
 
+// downloadUserAgent: UA khi tải PDF/ảnh (/merge, /thumb, resolve, verify, dedup, mirror).
+const downloadUserAgent = "WorksheetMerger/1.1 (+https://example.local)"
+
+// pdfRetryPolicy: retry cho downloadPDF (main ghi đè theo -retries).
+var pdfRetryPolicy = defaultRetryPolicy
+
 // downloadPDF:
 // - Nếu URL trả PDF (content-type hoặc đuôi .pdf) -> ghi file.
 // - Nếu trả HTML -> parse để tìm link .pdf / link "Download", rồi tải tiếp.
 // - Hỗ trợ "application/octet-stream" (nhiều site dùng khi tải file).
 func downloadPDF(u, outPath string) error {
-	client := &http.Client{Timeout: 60 * time.Second}
+	return downloadPDFWith(newPDFClient(), u, outPath)
+}
+
+// newPDFClient: client tải PDF cho /merge (retry theo -retries, timeout 60s).
+func newPDFClient() Fetcher {
+	return newRetryClient(nil, pdfRetryPolicy, 60*time.Second)
+}
 
+// downloadPDFWith: như downloadPDF nhưng dùng client cho sẵn (ví dụ client
+// có rate limit của crawler khi tải hàng loạt).
+func downloadPDFWith(client Fetcher, u, outPath string) error {
+	return downloadPDFHops(client, u, outPath, 0)
+}
+
+// downloadPDFHops: hops = số trang HTML đã đi qua; quá resolveMaxHops thì
+// dừng, cùng giới hạn với resolve và verify nên kết luận của chúng khớp.
+func downloadPDFHops(client Fetcher, u, outPath string, hops int) error {
 	// 1) Try GET u
 	req, err := http.NewRequest("GET", u, nil)
 	if err != nil {
 		return err
 	}
-	req.Header.Set("User-Agent", "WorksheetMerger/1.1 (+https://example.local)")
+	req.Header.Set("User-Agent", downloadUserAgent)
 	resp, err := client.Do(req)
 	if err != nil {
 		return err
@@ -38,7 +59,7 @@ func downloadPDF(u, outPath string) error {
 	}
 
 	ct := strings.ToLower(resp.Header.Get("Content-Type"))
-	if strings.Contains(ct, "pdf") || strings.HasSuffix(strings.ToLower(u), ".pdf") || ct == "application/octet-stream" {
+	if isPDFResponse(ct, u) {
 		f, err := os.Create(outPath)
 		if err != nil {
 			return err
@@ -58,12 +79,21 @@ func downloadPDF(u, outPath string) error {
 		if pdfURL == "" {
 			return fmt.Errorf("no direct PDF link found in HTML page: %s", u)
 		}
-		return downloadPDF(pdfURL, outPath)
+		if hops >= resolveMaxHops {
+			return fmt.Errorf("no PDF after %d pages: %s", resolveMaxHops, u)
+		}
+		return downloadPDFHops(client, pdfURL, outPath, hops+1)
 	}
 
 	return fmt.Errorf("unsupported content-type %s for %s", ct, u)
 }
 
+// isPDFResponse: luật nhận diện file PDF của downloadPDF, dùng chung cho
+// resolve pass và verify để kết luận khớp với lúc /merge tải thật.
+func isPDFResponse(ct, u string) bool {
+	return strings.Contains(ct, "pdf") || strings.HasSuffix(strings.ToLower(u), ".pdf") || ct == "application/octet-stream"
+}
+
 // Parse HTML để tìm <a href="...pdf"> hoặc anchor text có "download"/"pdf".
 func findPDFLinkInHTML(html, base string) string {
 	doc, err := goquery.NewDocumentFromReader(strings.NewReader(html))
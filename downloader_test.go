@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDownloadPDF(t *testing.T) {
+	const pdf = "%PDF-1.4 test"
+	pdfStep := scriptStep{status: 200, contentType: "application/pdf", body: pdf}
+	tests := []struct {
+		name     string
+		steps    map[string][]scriptStep
+		path     string
+		wantErr  string         // "" = tải được pdf
+		wantHits map[string]int // số request mỗi path
+	}{
+		{
+			name:     "direct pdf",
+			steps:    map[string][]scriptStep{"/a.pdf": {pdfStep}},
+			path:     "/a.pdf",
+			wantHits: map[string]int{"/a.pdf": 1},
+		},
+		{
+			name:     "503 with Retry-After then pdf",
+			steps:    map[string][]scriptStep{"/a.pdf": {{status: 503, retryAfter: "1"}, pdfStep}},
+			path:     "/a.pdf",
+			wantHits: map[string]int{"/a.pdf": 2},
+		},
+		{
+			name:     "429 then octet-stream",
+			steps:    map[string][]scriptStep{"/get": {{status: 429}, {status: 200, contentType: "application/octet-stream", body: pdf}}},
+			path:     "/get",
+			wantHits: map[string]int{"/get": 2},
+		},
+		{
+			name:     "connection reset then pdf",
+			steps:    map[string][]scriptStep{"/a.pdf": {{reset: true}, pdfStep}},
+			path:     "/a.pdf",
+			wantHits: map[string]int{"/a.pdf": 2},
+		},
+		{
+			name: "html page linking a flaky pdf",
+			steps: map[string][]scriptStep{
+				"/word-search/":          {{status: 200, contentType: "text/html", body: `<p><a href="/files/word-search.pdf">Download</a></p>`}},
+				"/files/word-search.pdf": {{status: 502}, pdfStep},
+			},
+			path:     "/word-search/",
+			wantHits: map[string]int{"/word-search/": 1, "/files/word-search.pdf": 2},
+		},
+		{
+			name:     "no retry on 404",
+			steps:    map[string][]scriptStep{"/gone.pdf": {{status: 404}, pdfStep}},
+			path:     "/gone.pdf",
+			wantErr:  "http 404",
+			wantHits: map[string]int{"/gone.pdf": 1},
+		},
+		{
+			name:     "gives up after retries",
+			steps:    map[string][]scriptStep{"/a.pdf": {{status: 500}}},
+			path:     "/a.pdf",
+			wantErr:  "http 500",
+			wantHits: map[string]int{"/a.pdf": 3},
+		},
+		{
+			name:     "html without pdf link",
+			steps:    map[string][]scriptStep{"/page/": {{status: 200, contentType: "text/html", body: `<p>nothing here</p>`}}},
+			path:     "/page/",
+			wantErr:  "no direct PDF link",
+			wantHits: map[string]int{"/page/": 1},
+		},
+	}
+
+	saved := pdfRetryPolicy
+	pdfRetryPolicy = testRetryPolicy(3)
+	t.Cleanup(func() { pdfRetryPolicy = saved })
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newScriptServer(t, tc.steps)
+			out := filepath.Join(t.TempDir(), "out.pdf")
+			err := downloadPDF(srv.URL+tc.path, out)
+			switch {
+			case tc.wantErr == "" && err != nil:
+				t.Fatalf("unexpected error: %v", err)
+			case tc.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tc.wantErr)):
+				t.Fatalf("error = %v, want %q", err, tc.wantErr)
+			case tc.wantErr == "":
+				if b, err := os.ReadFile(out); err != nil || string(b) != pdf {
+					t.Errorf("file = %q, %v; want %q", b, err, pdf)
+				}
+			}
+			for p, want := range tc.wantHits {
+				if got := srv.count(p); got != want {
+					t.Errorf("hits %s = %d, want %d", p, got, want)
+				}
+			}
+		})
+	}
+}
+
+// /merge (downloadPDF), resolve pass và verify đi qua cùng số trang HTML tối
+// đa (resolveMaxHops) trước khi gặp PDF, nên kết luận của chúng khớp nhau.
+func TestHopLimitShared(t *testing.T) {
+	// /c<n>/<i>: trang HTML thứ i của chuỗi n trang, trang n là PDF
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var n, i int
+		if _, err := fmt.Sscanf(r.URL.Path, "/c%d/%d", &n, &i); err != nil {
+			http.NotFound(w, r)
+			return
+		}
+		if i < n {
+			w.Header().Set("Content-Type", "text/html")
+			fmt.Fprintf(w, `<a href="/c%d/%d">Download</a>`, n, i+1)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		fmt.Fprint(w, "%PDF-1.4 test")
+	}))
+	defer srv.Close()
+
+	saved := pdfRetryPolicy
+	pdfRetryPolicy = testRetryPolicy(1)
+	t.Cleanup(func() { pdfRetryPolicy = saved })
+	robots := newRobotsCache(http.DefaultClient, downloadUserAgent, newHostLimiter(0, 0))
+
+	for n := 0; n <= resolveMaxHops+2; n++ {
+		u := fmt.Sprintf("%s/c%d/0", srv.URL, n)
+		want := n <= resolveMaxHops
+
+		err := downloadPDF(u, filepath.Join(t.TempDir(), "out.pdf"))
+		if (err == nil) != want {
+			t.Errorf("%d html pages: downloadPDF error = %v, want ok = %v", n, err, want)
+		}
+		_, err = resolvePDFURL(context.Background(), http.DefaultClient, robots, downloadUserAgent, u)
+		if (err == nil) != want {
+			t.Errorf("%d html pages: resolvePDFURL error = %v, want ok = %v", n, err, want)
+		}
+		if c := checkLink(http.DefaultClient, downloadUserAgent, u, "pdf"); c.OK != want {
+			t.Errorf("%d html pages: checkLink = %+v, want ok = %v", n, c, want)
+		}
+	}
+}
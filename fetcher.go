@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Fetcher: thứ crawl engine dùng để gửi request. *http.Client thoả mãn sẵn;
+// recordFetcher/replayFetcher cho phép ghi lại một lần crawl thật rồi chạy
+// lại offline (parse, dedup, checkpoint) mà không cần site sống.
+type Fetcher interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// ctxFetcher gắn ctx của lần crawl vào mọi request, để Source không cần
+// biết về context mà Ctrl-C / -crawl_timeout vẫn huỷ được request đang chạy.
+type ctxFetcher struct {
+	ctx  context.Context
+	next Fetcher
+}
+
+func (f ctxFetcher) Do(req *http.Request) (*http.Response, error) {
+	return f.next.Do(req.WithContext(f.ctx))
+}
+
+// fixtureMeta: phần header của một response đã ghi, lưu cạnh file body.
+type fixtureMeta struct {
+	Method      string `json:"method"`
+	URL         string `json:"url"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type,omitempty"`
+	Location    string `json:"location,omitempty"`
+}
+
+var fixtureSlugRe = regexp.MustCompile(`[^a-zA-Z0-9]+`)
+
+// fixturePath: <dir>/<host>/<slug của path>-<8 hex sha256(method url)>,
+// chưa kèm đuôi; tên file đọc được để dễ mở fixture bằng tay.
+func fixturePath(dir, method, rawURL string) string {
+	sum := sha256.Sum256([]byte(method + " " + rawURL))
+	host, slug := "unknown", "root"
+	if u, err := url.Parse(rawURL); err == nil {
+		if u.Host != "" {
+			host = fixtureSlugRe.ReplaceAllString(u.Host, "_")
+		}
+		if s := strings.Trim(fixtureSlugRe.ReplaceAllString(u.Path+"?"+u.RawQuery, "_"), "_"); s != "" {
+			slug = s
+		}
+	}
+	if len(slug) > 80 {
+		slug = slug[:80]
+	}
+	name := slug + "-" + hex.EncodeToString(sum[:4])
+	if method != http.MethodGet {
+		name = strings.ToLower(method) + "_" + name
+	}
+	return filepath.Join(dir, host, name)
+}
+
+// recordFetcher: gọi next rồi lưu response (mọi status) vào dir.
+type recordFetcher struct {
+	next Fetcher
+	dir  string
+}
+
+func (f *recordFetcher) Do(req *http.Request) (*http.Response, error) {
+	resp, err := f.next.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+
+	base := fixturePath(f.dir, req.Method, req.URL.String())
+	meta := fixtureMeta{
+		Method:      req.Method,
+		URL:         req.URL.String(),
+		Status:      resp.StatusCode,
+		ContentType: resp.Header.Get("Content-Type"),
+		Location:    resp.Request.URL.String(),
+	}
+	if meta.Location == meta.URL {
+		meta.Location = ""
+	}
+	if err := os.MkdirAll(filepath.Dir(base), 0o755); err == nil {
+		if err := writeFileAtomic(base+".body", body); err == nil {
+			_ = writeFileAtomic(base+".json", mustJSON(meta))
+		}
+	}
+	return resp, nil
+}
+
+// replayFetcher: trả response từ fixture, không đụng mạng. URL chưa ghi
+// trả 404 (X-Fixture: missing) để robots.txt thiếu vẫn được coi là cho phép
+// hết và trang thiếu đi vào nhánh lỗi bình thường của engine.
+type replayFetcher struct {
+	dir string
+}
+
+func newReplayFetcher(dir string) (*replayFetcher, error) {
+	if st, err := os.Stat(dir); err != nil {
+		return nil, err
+	} else if !st.IsDir() {
+		return nil, fmt.Errorf("%s is not a directory", dir)
+	}
+	return &replayFetcher{dir: dir}, nil
+}
+
+func (f *replayFetcher) Do(req *http.Request) (*http.Response, error) {
+	base := fixturePath(f.dir, req.Method, req.URL.String())
+	var meta fixtureMeta
+	b, err := os.ReadFile(base + ".json")
+	if err != nil || json.Unmarshal(b, &meta) != nil {
+		return fixtureResponse(req, http.StatusNotFound, http.Header{"X-Fixture": {"missing"}}, nil), nil
+	}
+	body, err := os.ReadFile(base + ".body")
+	if err != nil {
+		return nil, fmt.Errorf("fixture %s: %w", base, err)
+	}
+	h := http.Header{"X-Fixture": {"hit"}}
+	if meta.ContentType != "" {
+		h.Set("Content-Type", meta.ContentType)
+	}
+	resp := fixtureResponse(req, meta.Status, h, body)
+	if meta.Location != "" {
+		// giữ URL cuối sau redirect như lúc ghi (resolve/verify đọc resp.Request.URL)
+		if u, err := url.Parse(meta.Location); err == nil {
+			r2 := req.Clone(req.Context())
+			r2.URL = u
+			resp.Request = r2
+		}
+	}
+	return resp, nil
+}
+
+func fixtureResponse(req *http.Request, status int, h http.Header, body []byte) *http.Response {
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", status, http.StatusText(status)),
+		StatusCode:    status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}
+}
@@ -3,28 +3,99 @@ package main
 import (
 	"bufio"
 	"encoding/json"
-	"log"
 	"net/http"
-	"path/filepath"
-	"sort"
+	"net/url"
 	"strconv"
 	"strings"
+)
 
-	pdfapi "github.com/pdfcpu/pdfcpu/pkg/api"
+const (
+	indexPerPage    = 60
+	indexMaxPerPage = 240
 )
 
-func handleIndex(items []Item, outDir string) http.HandlerFunc {
+// indexPage: dữ liệu cho template index (một trang kết quả đã lọc).
+type indexPage struct {
+	Items    []Item
+	Version  int64
+	Thumbs   bool
+	Query    itemQuery
+	Subjects []string // subject + tag của cả catalog cho dropdown
+	Total    int      // số item khớp bộ lọc
+	All      int      // số item trong catalog
+	From, To int      // vị trí 1-based của trang hiện tại trong Total
+	Page     int
+	Pages    int
+	PrevURL  string
+	NextURL  string
+}
+
+// handleIndex: lọc (q, subject, hide_unresolved) và phân trang (page, per)
+// phía server; giỏ chọn nằm ở sessionStorage nên đổi trang không mất.
+// thumbs = có /thumb (-thumb_dir), không thì ảnh lấy thẳng từ img_url.
+func handleIndex(cat *Catalog, outDir string, thumbs bool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		// sort by Title asc
-		sort.Slice(items, func(i, j int) bool {
-			return strings.ToLower(items[i].Title) < strings.ToLower(items[j].Title)
-		})
-		data := struct{ Items []Item }{Items: items}
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		v := r.URL.Query()
+		view := cat.View()
+		q := parseItemQuery(v)
+		q.Source, q.Sort = "", "" // trang index luôn sort theo title
+		items, _ := view.Query(q)
+
+		per := indexPerPage
+		if n, err := strconv.Atoi(v.Get("per")); err == nil && n > 0 {
+			per = min(n, indexMaxPerPage)
+		}
+		pages := max(1, (len(items)+per-1)/per)
+		pg, _ := strconv.Atoi(v.Get("page"))
+		pg = min(max(pg, 1), pages)
+		from := (pg - 1) * per
+		to := min(from+per, len(items))
+
+		pageURL := func(n int) string {
+			u := url.Values{}
+			for _, k := range []string{"q", "subject", "hide_unresolved", "per"} {
+				if x := v.Get(k); x != "" {
+					u.Set(k, x)
+				}
+			}
+			if n > 1 {
+				u.Set("page", strconv.Itoa(n))
+			}
+			if len(u) == 0 {
+				return "/"
+			}
+			return "/?" + u.Encode()
+		}
+		data := indexPage{
+			Items:    items[from:to],
+			Version:  view.version,
+			Thumbs:   thumbs,
+			Query:    q,
+			Subjects: view.Labels(),
+			Total:    len(items),
+			All:      view.Len(),
+			From:     min(from+1, to),
+			To:       to,
+			Page:     pg,
+			Pages:    pages,
+		}
+		if pg > 1 {
+			data.PrevURL = pageURL(pg - 1)
+		}
+		if pg < pages {
+			data.NextURL = pageURL(pg + 1)
+		}
 		_ = page.Execute(w, data)
 	}
 }
 
-func handleMerge(outDir string) http.HandlerFunc {
+// handleMerge: POST /merge chỉ kiểm tra request rồi tạo job (jobs.go);
+// trả 202 kèm link trạng thái và stream tiến độ.
+func handleMerge(q *mergeQueue) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		var in MergeRequest
 		if err := json.NewDecoder(bufio.NewReader(r.Body)).Decode(&in); err != nil {
@@ -40,48 +111,19 @@ func handleMerge(outDir string) http.HandlerFunc {
 			outName = "merged_kiddo"
 		}
 		outName = sanitizeNoExt(outName) + ".pdf"
-		outPath := filepath.Join(outDir, outName)
 
-		tmpDir, err := osMkdirTemp("", "merge_dl_*")
+		j, err := q.submit(in.Files, outName)
 		if err != nil {
-			http.Error(w, `{"error":"cannot create temp dir"}`, http.StatusInternalServerError)
+			http.Error(w, `{"error":"`+escape(err.Error())+`"}`, http.StatusServiceUnavailable)
 			return
 		}
-		defer osRemoveAll(tmpDir)
-
-		var localFiles []string
-		var skipped []string
-
-		for i, u := range in.Files {
-			lp := filepath.Join(tmpDir, "f_"+strconv.Itoa(i)+".pdf")
-			if err := downloadPDF(u, lp); err != nil {
-				log.Printf("[skip] %s -> %v", u, err)
-				skipped = append(skipped, u)
-				continue
-			}
-			localFiles = append(localFiles, lp)
-		}
-
-		if len(localFiles) < 2 {
-			http.Error(w, `{"error":"not enough valid PDFs to merge","skipped":"`+escape(strings.Join(skipped, ","))+`"}`, http.StatusBadRequest)
-			return
-		}
-
-		// pdfcpu Merge
-		if err := pdfapi.MergeCreateFile(localFiles, outPath, false, nil); err != nil {
-			// fallback for older versions
-			if e2 := pdfapi.MergeAppendFile(localFiles, outPath, false, nil); e2 != nil {
-				http.Error(w, `{"error":"merge failed"}`, http.StatusInternalServerError)
-				return
-			}
-		}
-
 		resp := map[string]any{
-			"ok":       1,
-			"download": "/download/" + urlPath(outName),
-			"skipped":  skipped,
+			"job":    j.ID,
+			"status": "/jobs/" + j.ID,
+			"events": "/jobs/" + j.ID + "/events",
 		}
 		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusAccepted)
 		_ = json.NewEncoder(w).Encode(resp)
 	}
 }
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+)
+
+var (
+	cardTitleRe  = regexp.MustCompile(`<div class="card[^"]*" data-title="([^"]*)"`)
+	countLabelRe = regexp.MustCompile(`id="countLabel">([^<]*)<`)
+	pageLinkRe   = regexp.MustCompile(`<a class="btn small" href="([^"]*)">(‹ Prev|Next ›)</a>`)
+)
+
+// Trang index lọc và phân trang phía server; link Prev/Next giữ bộ lọc.
+func TestHandleIndexPagination(t *testing.T) {
+	items := make([]Item, 130)
+	for i := range items {
+		items[i] = Item{
+			Title:   fmt.Sprintf("Sheet %03d", i),
+			PDFURL:  fmt.Sprintf("https://x/%d.pdf", i),
+			Subject: []string{"Math", "Coloring"}[i%2],
+		}
+		if i%10 == 0 {
+			items[i].PDFStatus = "unresolved"
+		}
+	}
+	h := handleIndex(newCatalog(items), t.TempDir(), false)
+
+	tests := []struct {
+		query       string
+		cards       int
+		first, last string
+		label       string
+		prev, next  string
+	}{
+		{"", 60, "Sheet 000", "Sheet 059", "1–60 of 130 items", "", "/?page=2"},
+		{"page=2", 60, "Sheet 060", "Sheet 119", "61–120 of 130 items", "/", "/?page=3"},
+		{"page=3", 10, "Sheet 120", "Sheet 129", "121–130 of 130 items", "/?page=2", ""},
+		{"page=99", 10, "Sheet 120", "Sheet 129", "121–130 of 130 items", "/?page=2", ""}, // kẹp về trang cuối
+		{"page=-1&per=1000", 130, "Sheet 000", "Sheet 129", "1–130 of 130 items", "", ""}, // per tối đa indexMaxPerPage
+		// math = số chẵn (65), bỏ 13 item unresolved -> 52; trang 2 là vị trí 21-40
+		{"subject=math&hide_unresolved=1&per=20&page=2", 20, "Sheet 052", "Sheet 098", "21–40 of 52 items (filtered from 130)",
+			"/?hide_unresolved=1&per=20&subject=math", "/?hide_unresolved=1&page=3&per=20&subject=math"},
+		{"q=sheet+12&sort=-title&source=x", 12, "Sheet 012", "Sheet 129", "1–12 of 12 items (filtered from 130)", "", ""}, // 012, 112, 120-129; sort/source bị bỏ qua
+		{"q=nothing", 0, "", "", "No items (filtered from 130)", "", ""},
+	}
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/?"+tc.query, nil))
+		if rec.Code != http.StatusOK {
+			t.Errorf("%s: status %d", tc.query, rec.Code)
+			continue
+		}
+		body := rec.Body.String()
+
+		cards := cardTitleRe.FindAllStringSubmatch(body, -1)
+		if len(cards) != tc.cards {
+			t.Errorf("%s: %d cards, want %d", tc.query, len(cards), tc.cards)
+		} else if tc.cards > 0 && (cards[0][1] != tc.first || cards[len(cards)-1][1] != tc.last) {
+			t.Errorf("%s: cards %s..%s, want %s..%s", tc.query, cards[0][1], cards[len(cards)-1][1], tc.first, tc.last)
+		}
+		if m := countLabelRe.FindStringSubmatch(body); m == nil || m[1] != tc.label {
+			t.Errorf("%s: count label = %q, want %q", tc.query, m, tc.label)
+		}
+		var prev, next string
+		for _, m := range pageLinkRe.FindAllStringSubmatch(body, -1) {
+			if m[2] == "‹ Prev" {
+				prev = html.UnescapeString(m[1])
+			} else {
+				next = html.UnescapeString(m[1])
+			}
+		}
+		if prev != tc.prev || next != tc.next {
+			t.Errorf("%s: prev %q next %q, want %q and %q", tc.query, prev, next, tc.prev, tc.next)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	h(rec, httptest.NewRequest("GET", "/favicon.ico", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("/favicon.ico: status %d, want 404", rec.Code)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// cacheTransport: cache HTTP trên đĩa cho các request GET của crawler.
+//   - Entry còn trong MaxAge -> trả thẳng từ đĩa, không gọi mạng.
+//   - Hết hạn -> gửi If-None-Match/If-Modified-Since; 304 thì dùng lại body cũ.
+//   - Refresh = true -> bỏ qua cache, tải lại toàn bộ (vẫn ghi đè cache).
+type cacheTransport struct {
+	next    http.RoundTripper
+	dir     string
+	maxAge  time.Duration
+	refresh bool
+}
+
+type cacheMeta struct {
+	URL          string    `json:"url"`
+	ContentType  string    `json:"content_type,omitempty"`
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	StoredAt     time.Time `json:"stored_at"`
+}
+
+func (t *cacheTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet || req.Header.Get("Range") != "" {
+		return t.next.RoundTrip(req)
+	}
+
+	base := t.entryPath(req.URL.String())
+	meta, haveMeta := t.readMeta(base)
+
+	if haveMeta && !t.refresh {
+		if t.maxAge > 0 && time.Since(meta.StoredAt) < t.maxAge {
+			if resp, err := t.cachedResponse(req, base, meta); err == nil {
+				return resp, nil
+			}
+		}
+		// revalidate: clone để không sửa request của caller
+		req = req.Clone(req.Context())
+		if meta.ETag != "" {
+			req.Header.Set("If-None-Match", meta.ETag)
+		}
+		if meta.LastModified != "" {
+			req.Header.Set("If-Modified-Since", meta.LastModified)
+		}
+	}
+
+	resp, err := t.next.RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case resp.StatusCode == http.StatusNotModified && haveMeta:
+		resp.Body.Close()
+		meta.StoredAt = time.Now()
+		_ = writeFileAtomic(base+".json", mustJSON(meta))
+		return t.cachedResponse(req, base, meta)
+
+	case resp.StatusCode == http.StatusOK:
+		body, err := io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		meta = cacheMeta{
+			URL:          req.URL.String(),
+			ContentType:  resp.Header.Get("Content-Type"),
+			ETag:         resp.Header.Get("ETag"),
+			LastModified: resp.Header.Get("Last-Modified"),
+			StoredAt:     time.Now(),
+		}
+		if err := os.MkdirAll(filepath.Dir(base), 0o755); err == nil {
+			if err := writeFileAtomic(base+".body", body); err == nil {
+				_ = writeFileAtomic(base+".json", mustJSON(meta))
+			}
+		}
+		resp.Body = io.NopCloser(bytes.NewReader(body))
+		return resp, nil
+	}
+	return resp, nil
+}
+
+// entryPath: <dir>/<2 ký tự đầu sha256>/<sha256 của URL>, chưa kèm đuôi.
+func (t *cacheTransport) entryPath(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	h := hex.EncodeToString(sum[:])
+	return filepath.Join(t.dir, h[:2], h)
+}
+
+func (t *cacheTransport) readMeta(base string) (cacheMeta, bool) {
+	var m cacheMeta
+	b, err := os.ReadFile(base + ".json")
+	if err != nil || json.Unmarshal(b, &m) != nil {
+		return m, false
+	}
+	if _, err := os.Stat(base + ".body"); err != nil {
+		return m, false
+	}
+	return m, true
+}
+
+func (t *cacheTransport) cachedResponse(req *http.Request, base string, meta cacheMeta) (*http.Response, error) {
+	body, err := os.ReadFile(base + ".body")
+	if err != nil {
+		return nil, err
+	}
+	h := http.Header{}
+	h.Set("X-Cache", "HIT")
+	if meta.ContentType != "" {
+		h.Set("Content-Type", meta.ContentType)
+	}
+	if meta.ETag != "" {
+		h.Set("ETag", meta.ETag)
+	}
+	if meta.LastModified != "" {
+		h.Set("Last-Modified", meta.LastModified)
+	}
+	return &http.Response{
+		Status:        "200 OK",
+		StatusCode:    http.StatusOK,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        h,
+		Body:          io.NopCloser(bytes.NewReader(body)),
+		ContentLength: int64(len(body)),
+		Request:       req,
+	}, nil
+}
+
+func mustJSON(v any) []byte {
+	b, _ := json.Marshal(v)
+	return b
+}
+
+// writeFileAtomic: ghi ra file .tmp rồi rename để không bao giờ để lại file dở.
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
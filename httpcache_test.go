@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// condServer: trang có version, trả 304 khi If-None-Match / If-Modified-Since
+// còn khớp; ghi lại header điều kiện của từng request.
+type condServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	version  int
+	useETag  bool
+	requests []http.Header
+}
+
+const condLastModified = "Mon, 01 Jan 2024 00:00:00 GMT"
+
+func newCondServer(t *testing.T, useETag bool) *condServer {
+	t.Helper()
+	s := &condServer{version: 1, useETag: useETag}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		s.requests = append(s.requests, r.Header.Clone())
+		if r.URL.Path != "/page" {
+			http.NotFound(w, r)
+			return
+		}
+		etag := fmt.Sprintf(`"v%d"`, s.version)
+		lastMod := condLastModified
+		if s.version > 1 {
+			lastMod = "Tue, 02 Jan 2024 00:00:00 GMT"
+		}
+		if s.useETag {
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		} else {
+			w.Header().Set("Last-Modified", lastMod)
+			if r.Header.Get("If-Modified-Since") == lastMod {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprintf(w, "<h1>version %d</h1>", s.version)
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *condServer) last() http.Header {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.requests[len(s.requests)-1]
+}
+
+func (s *condServer) hits() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.requests)
+}
+
+func cacheGet(t *testing.T, c *http.Client, u string) (status int, body, xcache string) {
+	t.Helper()
+	resp, err := c.Get(u)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	b, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp.StatusCode, string(b), resp.Header.Get("X-Cache")
+}
+
+func TestCacheTransportRevalidate(t *testing.T) {
+	tests := []struct {
+		name     string
+		useETag  bool
+		header   string // header điều kiện phải gửi khi revalidate
+		wantCond string
+	}{
+		{"etag", true, "If-None-Match", `"v1"`},
+		{"last-modified", false, "If-Modified-Since", condLastModified},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newCondServer(t, tc.useETag)
+			c := &http.Client{Transport: &cacheTransport{next: http.DefaultTransport, dir: t.TempDir()}}
+			u := srv.URL + "/page"
+
+			// lần đầu: tải và ghi cache
+			status, body, xc := cacheGet(t, c, u)
+			if status != 200 || body != "<h1>version 1</h1>" || xc != "" {
+				t.Fatalf("first GET = %d %q X-Cache=%q", status, body, xc)
+			}
+			if h := srv.last().Get(tc.header); h != "" {
+				t.Errorf("first GET sent %s: %q", tc.header, h)
+			}
+
+			// maxAge = 0: revalidate, server trả 304, body lấy từ đĩa
+			status, body, xc = cacheGet(t, c, u)
+			if status != 200 || body != "<h1>version 1</h1>" || xc != "HIT" {
+				t.Errorf("revalidated GET = %d %q X-Cache=%q, want 200 from disk", status, body, xc)
+			}
+			if h := srv.last().Get(tc.header); h != tc.wantCond {
+				t.Errorf("%s = %q, want %q", tc.header, h, tc.wantCond)
+			}
+
+			// nội dung đổi: 200 mới thay cache
+			srv.mu.Lock()
+			srv.version = 2
+			srv.mu.Unlock()
+			status, body, xc = cacheGet(t, c, u)
+			if status != 200 || body != "<h1>version 2</h1>" || xc != "" {
+				t.Errorf("changed GET = %d %q X-Cache=%q, want fresh version 2", status, body, xc)
+			}
+			status, body, xc = cacheGet(t, c, u)
+			if body != "<h1>version 2</h1>" || xc != "HIT" {
+				t.Errorf("GET after change = %d %q X-Cache=%q, want version 2 from disk", status, body, xc)
+			}
+			if got := srv.hits(); got != 4 {
+				t.Errorf("server hits = %d, want 4", got)
+			}
+		})
+	}
+}
+
+func TestCacheTransportMaxAgeAndRefresh(t *testing.T) {
+	srv := newCondServer(t, true)
+	dir := t.TempDir()
+	u := srv.URL + "/page"
+
+	fresh := &http.Client{Transport: &cacheTransport{next: http.DefaultTransport, dir: dir, maxAge: time.Hour}}
+	cacheGet(t, fresh, u)
+	if _, body, xc := cacheGet(t, fresh, u); body != "<h1>version 1</h1>" || xc != "HIT" {
+		t.Errorf("GET within maxAge = %q X-Cache=%q, want cached", body, xc)
+	}
+	if got := srv.hits(); got != 1 {
+		t.Errorf("hits within maxAge = %d, want 1 (no network)", got)
+	}
+
+	refresh := &http.Client{Transport: &cacheTransport{next: http.DefaultTransport, dir: dir, maxAge: time.Hour, refresh: true}}
+	if _, _, xc := cacheGet(t, refresh, u); xc != "" {
+		t.Errorf("refresh GET X-Cache = %q, want full download", xc)
+	}
+	if h := srv.last().Get("If-None-Match"); h != "" {
+		t.Errorf("refresh sent If-None-Match %q, want unconditional GET", h)
+	}
+
+	// lỗi không được cache
+	for i := 0; i < 2; i++ {
+		if status, _, xc := cacheGet(t, fresh, srv.URL+"/missing"); status != 404 || xc != "" {
+			t.Errorf("missing GET = %d X-Cache=%q, want uncached 404", status, xc)
+		}
+	}
+	if got := srv.hits(); got != 4 {
+		t.Errorf("hits = %d, want 4", got)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+// crawlAttemptTimeout: thời gian tối đa cho một lần thử request của crawler.
+const crawlAttemptTimeout = 30 * time.Second
+
+// newCrawlClient: http.Client dùng chung cho list + detail của một lần crawl,
+// giới hạn tốc độ theo host (RatePerSec/Burst, hoặc suy từ DelayMs) và
+// retry lỗi tạm thời theo retryPolicy (cfg.Retry lần).
+// Nếu có CacheDir thì bọc thêm cache trên đĩa ở ngoài cùng, để request
+// trả từ cache không tốn token của limiter.
+// Trả kèm limiter để robots.txt có thể siết Crawl-delay theo host.
+func newCrawlClient(cfg CrawlConfig) (*http.Client, *hostLimiter) {
+	base := http.DefaultTransport.(*http.Transport).Clone()
+	if cfg.Workers > base.MaxIdleConnsPerHost {
+		base.MaxIdleConnsPerHost = cfg.Workers
+	}
+	rate := cfg.RatePerSec
+	if rate <= 0 && cfg.DelayMs > 0 {
+		// tương thích -delay cũ: 1 request mỗi DelayMs cho mỗi host
+		rate = 1000 / float64(cfg.DelayMs)
+	}
+	lim := newHostLimiter(rate, cfg.Burst)
+	policy := withRetries(cfg.Retry)
+
+	// cache -> retry -> rate limit -> mạng: mỗi lần retry đều chờ limiter
+	var rt http.RoundTripper = &rateLimitTransport{next: base, lim: lim}
+	rt = &retryTransport{next: rt, policy: policy, perAttempt: crawlAttemptTimeout}
+	if cfg.CacheDir != "" {
+		rt = &cacheTransport{next: rt, dir: cfg.CacheDir, maxAge: cfg.CacheMaxAge, refresh: cfg.CacheRefresh}
+	}
+	return &http.Client{Timeout: policy.clientTimeout(crawlAttemptTimeout), Transport: rt}, lim
+}
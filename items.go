@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"encoding/json"
 	"fmt"
-	"net/http"
 	"net/url"
 	"os"
 	"regexp"
@@ -19,7 +18,46 @@ const (
 	userAgent = "KiddoCrawler-Items/1.0 (+https://example.local)"
 )
 
-func findMaxPages(client *http.Client) (int, error) {
+func init() {
+	registerSource("kiddo", func(string) Source { return kiddoSource{} })
+}
+
+// kiddoSource: kiddoworksheets.com, list ở /all-downloads/page/N/.
+type kiddoSource struct{}
+
+func (kiddoSource) Name() string      { return "kiddo" }
+func (kiddoSource) UserAgent() string { return userAgent }
+func (kiddoSource) ListURL(p int) string {
+	return resolveListURL(p)
+}
+func (kiddoSource) FindMaxPages(client Fetcher) (int, error) {
+	return findMaxPages(client)
+}
+func (kiddoSource) SitemapURL() string        { return baseURL + "/sitemap.xml" }
+func (kiddoSource) IsDetailURL(u string) bool { return isDetailURL(u) }
+func (kiddoSource) ParseDetail(client Fetcher, detailURL string) ([]Item, error) {
+	return parseDetail(client, detailURL)
+}
+
+// ExtractDetailLinks: link chi tiết + map thumbnail từ <img> nằm trong anchor.
+func (kiddoSource) ExtractDetailLinks(doc *goquery.Document) ([]string, map[string]string) {
+	thumbByDetail := make(map[string]string)
+	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
+		href, _ := a.Attr("href")
+		href = toAbs(href)
+		if !isDetailURL(href) {
+			return
+		}
+		if img := a.Find("img"); img.Length() > 0 {
+			if src, ok := img.Attr("src"); ok && src != "" {
+				thumbByDetail[href] = toAbs(src)
+			}
+		}
+	})
+	return extractDetailLinks(doc, baseURL), thumbByDetail
+}
+
+func findMaxPages(client Fetcher) (int, error) {
 	doc, err := fetchDoc(client, baseURL+listPath)
 	if err != nil {
 		return 0, err
@@ -80,10 +118,10 @@ func isDetailURL(href string) bool {
 	return false
 }
 
-func parseDetail(client *http.Client, detailURL string) (Item, error) {
+func parseDetail(client Fetcher, detailURL string) ([]Item, error) {
 	doc, err := fetchDoc(client, detailURL)
 	if err != nil {
-		return Item{}, err
+		return nil, err
 	}
 
 	// title
@@ -92,24 +130,9 @@ func parseDetail(client *http.Client, detailURL string) (Item, error) {
 		title = fallbackTitle(detailURL)
 	}
 
-	// pdf candidates
-	var pdf string
-	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
-		h, _ := a.Attr("href")
-		h = toAbs(h)
-		txt := strings.ToLower(strings.TrimSpace(a.Text()))
-		if strings.HasSuffix(strings.ToLower(h), ".pdf") {
-			if pdf == "" {
-				pdf = h
-			}
-		} else if strings.Contains(txt, "download") || strings.Contains(txt, "pdf") {
-			if pdf == "" {
-				pdf = h
-			}
-		}
-	})
-	// prefer direct .pdf
-	// (nếu không đuôi .pdf, để nguyên — có thể là link tải có redirect)
+	// pdf candidates: mọi link .pdf trên trang, mỗi link thành một item
+	// (không có .pdf thì lấy link "download"/"pdf" đầu tiên — có thể là link tải có redirect)
+	pdfs := collectPDFLinks(doc, "a[href]", []string{".pdf"}, []string{"download", "pdf"}, toAbs)
 
 	// image: prefer OG image
 	var img string
@@ -167,15 +190,15 @@ func parseDetail(client *http.Client, detailURL string) (Item, error) {
 		})
 	}
 
-	// 3) Nếu vẫn chưa có: thử lấy từ category/tag
+	// 3) category/tag: luôn gom làm tags; subject vẫn trống thì chọn từ đây
+	var candidates []string
+	doc.Find(`a[rel="category tag"], a[href*="/category/"], a[href*="/tags/"], a[href*="/tag/"]`).Each(func(_ int, a *goquery.Selection) {
+		t := cleanText(a.Text())
+		if t != "" {
+			candidates = append(candidates, t)
+		}
+	})
 	if subject == "" {
-		var candidates []string
-		doc.Find(`a[rel="category tag"], a[href*="/category/"], a[href*="/tags/"], a[href*="/tag/"]`).Each(func(_ int, a *goquery.Selection) {
-			t := cleanText(a.Text())
-			if t != "" {
-				candidates = append(candidates, t)
-			}
-		})
 		if s := pickLikelySubject(candidates); s != "" {
 			subject = s
 		} else if len(candidates) > 0 {
@@ -183,13 +206,13 @@ func parseDetail(client *http.Client, detailURL string) (Item, error) {
 		}
 	}
 
-	return Item{
+	return pdfItems(Item{
 		Title:   title,
-		PDFURL:  pdf,
 		IMGURL:  img,
 		URL:     detailURL,
 		Subject: subject,
-	}, nil
+		Tags:    candidates,
+	}, pdfs), nil
 }
 
 // ---- utils ----
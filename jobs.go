@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	pdfapi "github.com/pdfcpu/pdfcpu/pkg/api"
+)
+
+const (
+	mergeQueueSize = 64
+	mergeJobTTL    = time.Hour // job xong quá lâu thì bỏ khỏi bộ nhớ
+)
+
+// mergeOptions: giới hạn tải PDF trong một job merge.
+type mergeOptions struct {
+	Concurrency int           // số file tải song song trong một job
+	PerHost     int           // số request đồng thời tối đa tới cùng một host (mọi job cộng lại)
+	FileTimeout time.Duration // cho mỗi file (gồm cả retry và trang HTML trung gian); 0 = không giới hạn
+	Deadline    time.Duration // cho cả job, từ lúc bắt đầu tải tới lúc merge; 0 = không giới hạn
+}
+
+// jobFile: tiến độ của một PDF trong job.
+type jobFile struct {
+	URL   string `json:"url"`
+	State string `json:"state"` // pending | downloading | done | cached | skipped
+	Error string `json:"error,omitempty"`
+}
+
+// mergeJob: một lần /merge chạy nền. Mọi field đọc/ghi dưới mu; mỗi lần
+// đổi thì đóng changed để các stream SSE đang chờ gửi trạng thái mới.
+type mergeJob struct {
+	mu sync.Mutex
+
+	ID       string     `json:"id"`
+	State    string     `json:"state"` // queued | downloading | merging | done | failed
+	Out      string     `json:"out"`
+	Files    []jobFile  `json:"files"`
+	Done     int        `json:"done"` // số file đã xử lý xong (tải được hoặc bỏ qua)
+	Download string     `json:"download,omitempty"`
+	Skipped  []string   `json:"skipped,omitempty"`
+	Error    string     `json:"error,omitempty"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+
+	changed chan struct{}
+}
+
+func (j *mergeJob) finished() bool { return j.State == "done" || j.State == "failed" }
+
+// update sửa job dưới khoá rồi báo cho người đang theo dõi.
+func (j *mergeJob) update(fn func(j *mergeJob)) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	fn(j)
+	if j.finished() && j.Finished == nil {
+		now := time.Now()
+		j.Finished = &now
+	}
+	close(j.changed)
+	j.changed = make(chan struct{})
+}
+
+// snapshot: JSON hiện tại, đã xong chưa, và channel đóng ở lần đổi kế tiếp.
+func (j *mergeJob) snapshot() ([]byte, bool, <-chan struct{}) {
+	j.mu.Lock()
+	defer j.mu.Unlock()
+	b, _ := json.Marshal(j)
+	return b, j.finished(), j.changed
+}
+
+func (j *mergeJob) setFile(i int, state string, err error) {
+	j.update(func(j *mergeJob) {
+		j.Files[i].State = state
+		if err != nil {
+			j.Files[i].Error = err.Error()
+		}
+		if state != "downloading" {
+			j.Done++
+		}
+		if state == "skipped" {
+			j.Skipped = append(j.Skipped, j.Files[i].URL)
+		}
+	})
+}
+
+// mergeQueue: hàng đợi job + worker pool chạy merge nền.
+type mergeQueue struct {
+	ctx    context.Context
+	outDir string
+	mirror *pdfMirror
+	opts   mergeOptions
+	hosts  *hostSlots
+
+	mu    sync.Mutex
+	jobs  map[string]*mergeJob
+	queue chan *mergeJob
+}
+
+func newMergeQueue(ctx context.Context, workers int, outDir string, mirror *pdfMirror, opts mergeOptions) *mergeQueue {
+	opts.Concurrency = max(opts.Concurrency, 1)
+	opts.PerHost = max(opts.PerHost, 1)
+	q := &mergeQueue{
+		ctx:    ctx,
+		outDir: outDir,
+		mirror: mirror,
+		opts:   opts,
+		hosts:  &hostSlots{n: opts.PerHost, slots: map[string]chan struct{}{}},
+		jobs:   map[string]*mergeJob{},
+		queue:  make(chan *mergeJob, mergeQueueSize),
+	}
+	for w := 0; w < max(workers, 1); w++ {
+		go func() {
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case j := <-q.queue:
+					q.run(j)
+				}
+			}
+		}()
+	}
+	return q
+}
+
+var errQueueFull = errors.New("merge queue is full, try again later")
+
+// submit tạo job mới cho files và xếp hàng.
+func (q *mergeQueue) submit(files []string, outName string) (*mergeJob, error) {
+	id := make([]byte, 8)
+	_, _ = rand.Read(id)
+	j := &mergeJob{
+		ID:      hex.EncodeToString(id),
+		State:   "queued",
+		Out:     outName,
+		Files:   make([]jobFile, len(files)),
+		Created: time.Now(),
+		changed: make(chan struct{}),
+	}
+	for i, u := range files {
+		j.Files[i] = jobFile{URL: u, State: "pending"}
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.prune()
+	select {
+	case q.queue <- j:
+	default:
+		return nil, errQueueFull
+	}
+	q.jobs[j.ID] = j
+	return j, nil
+}
+
+// prune bỏ job đã xong quá mergeJobTTL (gọi khi đang giữ q.mu).
+func (q *mergeQueue) prune() {
+	for id, j := range q.jobs {
+		j.mu.Lock()
+		old := j.Finished != nil && time.Since(*j.Finished) > mergeJobTTL
+		j.mu.Unlock()
+		if old {
+			delete(q.jobs, id)
+		}
+	}
+}
+
+func (q *mergeQueue) get(id string) (*mergeJob, bool) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	j, ok := q.jobs[id]
+	return j, ok
+}
+
+// run: tải các PDF song song (mirror trước nếu có) rồi merge bằng pdfcpu
+// theo đúng thứ tự người dùng chọn.
+func (q *mergeQueue) run(j *mergeJob) {
+	fail := func(msg string) {
+		log.Printf("[merge %s] %s", j.ID, msg)
+		j.update(func(j *mergeJob) { j.State, j.Error = "failed", msg })
+	}
+	j.update(func(j *mergeJob) { j.State = "downloading" })
+
+	ctx, cancel := q.ctx, context.CancelFunc(func() {})
+	if q.opts.Deadline > 0 {
+		ctx, cancel = context.WithTimeout(ctx, q.opts.Deadline)
+	}
+	defer cancel()
+
+	tmpDir, err := osMkdirTemp("", "merge_dl_*")
+	if err != nil {
+		fail("cannot create temp dir")
+		return
+	}
+	defer osRemoveAll(tmpDir)
+
+	// mỗi file một ô trong paths nên thứ tự không phụ thuộc file nào tải xong trước
+	paths := make([]string, len(j.Files))
+	_ = forEachParallel(ctx, len(j.Files), q.opts.Concurrency, func(i int) {
+		u := j.Files[i].URL
+		lp, cached, err := q.fetchFile(ctx, u, filepath.Join(tmpDir, "f_"+strconv.Itoa(i)+".pdf"), func() {
+			j.setFile(i, "downloading", nil)
+		})
+		if err != nil {
+			log.Printf("[skip] %s -> %v", u, err)
+			j.setFile(i, "skipped", err)
+			return
+		}
+		paths[i] = lp
+		j.setFile(i, tern(cached, "cached", "done"), nil)
+	})
+
+	if q.mirror != nil {
+		if err := q.mirror.Save(); err != nil {
+			log.Printf("[mirror] save index: %v", err)
+		}
+	}
+	if ctx.Err() != nil {
+		fail("merge deadline exceeded while downloading")
+		return
+	}
+
+	var localFiles []string
+	for _, p := range paths {
+		if p != "" {
+			localFiles = append(localFiles, p)
+		}
+	}
+	if len(localFiles) < 2 {
+		fail("not enough valid PDFs to merge")
+		return
+	}
+
+	j.update(func(j *mergeJob) { j.State = "merging" })
+	outPath := filepath.Join(q.outDir, j.Out)
+	// pdfcpu Merge
+	if err := pdfapi.MergeCreateFile(localFiles, outPath, false, nil); err != nil {
+		// fallback for older versions
+		if e2 := pdfapi.MergeAppendFile(localFiles, outPath, false, nil); e2 != nil {
+			fail("merge failed")
+			return
+		}
+	}
+	j.update(func(j *mergeJob) {
+		j.State = "done"
+		j.Download = "/download/" + urlPath(j.Out)
+	})
+}
+
+// fetchFile: lấy một file, mirror trước (cached = true, không cần slot),
+// chưa có thì tải với timeout riêng, giữ một slot của host trong lúc tải;
+// started được gọi khi thật sự bắt đầu tải (sau khi có slot).
+func (q *mergeQueue) fetchFile(ctx context.Context, u, tmpPath string, started func()) (string, bool, error) {
+	if q.mirror != nil {
+		if lp, _, ok := q.mirror.Lookup(u); ok {
+			return lp, true, nil
+		}
+	}
+	host := ""
+	if pu, err := url.Parse(u); err == nil {
+		host = strings.ToLower(pu.Host)
+	}
+	release, err := q.hosts.acquire(ctx, host)
+	if err != nil {
+		return "", false, err
+	}
+	defer release()
+	started()
+
+	if q.opts.FileTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, q.opts.FileTimeout)
+		defer cancel()
+	}
+	lp, err := q.download(ctxFetcher{ctx: ctx, next: newPDFClient()}, u, tmpPath)
+	return lp, false, err
+}
+
+// download tải u từ origin (fetchFile đã Lookup mirror): có mirror thì lưu
+// vào mirror cho lần sau và trả object trong mirror, không thì ghi tmpPath.
+func (q *mergeQueue) download(client Fetcher, u, tmpPath string) (string, error) {
+	if q.mirror != nil {
+		lp, _, err := q.mirror.Fetch(client, u)
+		return lp, err
+	}
+	return tmpPath, downloadPDFWith(client, u, tmpPath)
+}
+
+// hostSlots: giới hạn số request đồng thời tới mỗi host (semaphore theo host).
+type hostSlots struct {
+	n     int
+	mu    sync.Mutex
+	slots map[string]chan struct{}
+}
+
+func (h *hostSlots) acquire(ctx context.Context, host string) (func(), error) {
+	h.mu.Lock()
+	ch, ok := h.slots[host]
+	if !ok {
+		ch = make(chan struct{}, h.n)
+		h.slots[host] = ch
+	}
+	h.mu.Unlock()
+	select {
+	case ch <- struct{}{}:
+		return func() { <-ch }, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// handleJob: GET /jobs/{id} -> trạng thái job.
+func handleJob(q *mergeQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := q.get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, `{"error":"job not found"}`, http.StatusNotFound)
+			return
+		}
+		b, _, _ := j.snapshot()
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(b)
+	}
+}
+
+// handleJobEvents: GET /jobs/{id}/events -> Server-Sent Events, mỗi lần job
+// đổi gửi một event "progress" (JSON như /jobs/{id}), xong thì gửi "done".
+func handleJobEvents(q *mergeQueue) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		j, ok := q.get(r.PathValue("id"))
+		if !ok {
+			http.Error(w, `{"error":"job not found"}`, http.StatusNotFound)
+			return
+		}
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, `{"error":"streaming unsupported"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+		for {
+			b, done, changed := j.snapshot()
+			event := tern(done, "done", "progress")
+			if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, b); err != nil {
+				return
+			}
+			flusher.Flush()
+			if done {
+				return
+			}
+			for waiting := true; waiting; {
+				select {
+				case <-r.Context().Done():
+					return
+				case <-changed:
+					waiting = false
+				case <-keepAlive.C:
+					// comment SSE giữ kết nối qua proxy khi một file tải lâu
+					if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+						return
+					}
+					flusher.Flush()
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// testPDF: PDF một trang, content stream không nén có text nên tìm được
+// trong file merge để kiểm tra thứ tự trang.
+func testPDF(text string) []byte {
+	stream := "BT /F1 12 Tf 20 100 Td (" + text + ") Tj ET"
+	objs := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 200 200] /Contents 4 0 R >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%s\nendstream", len(stream), stream),
+	}
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objs))
+	for i, o := range objs {
+		offsets[i] = b.Len()
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, o)
+	}
+	xref := b.Len()
+	fmt.Fprintf(&b, "xref\n0 %d\n0000000000 65535 f \n", len(objs)+1)
+	for _, o := range offsets {
+		fmt.Fprintf(&b, "%010d 00000 n \n", o)
+	}
+	fmt.Fprintf(&b, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objs)+1, xref)
+	return b.Bytes()
+}
+
+// concurrency đếm số request đang chạy, đỉnh cao nhất và tổng số request.
+type concurrency struct {
+	mu               sync.Mutex
+	cur, peak, total int
+}
+
+func (c *concurrency) enter() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cur++
+	c.total++
+	c.peak = max(c.peak, c.cur)
+}
+
+func (c *concurrency) leave() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.cur--
+}
+
+func (c *concurrency) max() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.peak
+}
+
+func (c *concurrency) count() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.total
+}
+
+// newPDFServer: /<name>.pdf trả testPDF(name) sau delay (slow[name] nếu có),
+// /bad.pdf trả 404. Mọi request được đếm vào host và all.
+func newPDFServer(t *testing.T, delay time.Duration, slow map[string]time.Duration, host, all *concurrency) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host.enter()
+		defer host.leave()
+		all.enter()
+		defer all.leave()
+		if r.URL.Path == "/bad.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/"), ".pdf")
+		d := delay
+		if s, ok := slow[name]; ok {
+			d = s
+		}
+		time.Sleep(d)
+		w.Header().Set("Content-Type", "application/pdf")
+		_, _ = w.Write(testPDF(name))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func waitJob(t *testing.T, j *mergeJob) *mergeJob {
+	t.Helper()
+	deadline := time.Now().Add(20 * time.Second)
+	for {
+		b, done, changed := j.snapshot()
+		if done {
+			var out mergeJob
+			if err := json.Unmarshal(b, &out); err != nil {
+				t.Fatal(err)
+			}
+			return &out
+		}
+		select {
+		case <-changed:
+		case <-time.After(time.Until(deadline)):
+			t.Fatalf("job %s not finished: %s", j.ID, b)
+		}
+	}
+}
+
+// Nhiều file tải song song nhưng mỗi host (cộng mọi job) không quá PerHost
+// request cùng lúc; file merge giữ đúng thứ tự người dùng chọn dù file đầu
+// tải xong sau cùng.
+func TestMergeJobPerHostLimit(t *testing.T) {
+	var hostA, hostB, all concurrency
+	a := newPDFServer(t, 100*time.Millisecond, map[string]time.Duration{"a0": 400 * time.Millisecond}, &hostA, &all)
+	b := newPDFServer(t, 100*time.Millisecond, nil, &hostB, &all)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	q := newMergeQueue(ctx, 2, dir, nil, mergeOptions{Concurrency: 4, PerHost: 2, FileTimeout: 10 * time.Second})
+
+	names := []string{"a0", "b0", "a1", "b1", "a2", "b2", "a3", "b3"}
+	var files []string
+	for _, n := range names {
+		files = append(files, tern(n[0] == 'a', a.URL, b.URL)+"/"+n+".pdf")
+	}
+	j1, err := q.submit(files, "ordered.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// job thứ hai chạy cùng lúc trên host a: slot của host dùng chung
+	j2, err := q.submit([]string{a.URL + "/x0.pdf", a.URL + "/x1.pdf", a.URL + "/x2.pdf"}, "other.pdf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, j := range []*mergeJob{waitJob(t, j1), waitJob(t, j2)} {
+		if j.State != "done" || j.Done != len(j.Files) || len(j.Skipped) != 0 {
+			t.Errorf("job %s: state %s done %d/%d skipped %v error %q", j.Out, j.State, j.Done, len(j.Files), j.Skipped, j.Error)
+		}
+	}
+	if got := hostA.max(); got > 2 {
+		t.Errorf("host a: %d concurrent requests, want at most 2", got)
+	}
+	if got := hostB.max(); got > 2 {
+		t.Errorf("host b: %d concurrent requests, want at most 2", got)
+	}
+	if got := all.max(); got < 3 {
+		t.Errorf("peak over both hosts = %d, want > 2 (the limit is per host)", got)
+	}
+
+	merged, err := os.ReadFile(filepath.Join(dir, "ordered.pdf"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := -1
+	for _, n := range names {
+		i := bytes.Index(merged, []byte("("+n+")"))
+		if i < 0 || i < last {
+			t.Errorf("page %s at offset %d (previous page at %d): want pages in request order %v", n, i, last, names)
+		}
+		last = i
+	}
+}
+
+type sseEvent struct {
+	name string
+	job  *mergeJob
+}
+
+func readSSE(t *testing.T, resp *http.Response) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var name string
+	sc := bufio.NewScanner(resp.Body)
+	for sc.Scan() {
+		line := sc.Text()
+		switch {
+		case strings.HasPrefix(line, "event: "):
+			name = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			ev := sseEvent{name: name, job: &mergeJob{}}
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), ev.job); err != nil {
+				t.Fatalf("event data %q: %v", line, err)
+			}
+			events = append(events, ev)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return events
+}
+
+// POST /merge trả 202 ngay; /jobs/{id}/events stream tiến độ tới event
+// "done" cuối cùng, /jobs/{id} trả đúng trạng thái đó.
+func TestMergeJobEvents(t *testing.T) {
+	var host, all concurrency
+	pdfs := newPDFServer(t, 50*time.Millisecond, nil, &host, &all)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	dir := t.TempDir()
+	q := newMergeQueue(ctx, 1, dir, nil, mergeOptions{Concurrency: 2, PerHost: 2})
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /merge", handleMerge(q))
+	mux.HandleFunc("GET /jobs/{id}", handleJob(q))
+	mux.HandleFunc("GET /jobs/{id}/events", handleJobEvents(q))
+	app := httptest.NewServer(mux)
+	defer app.Close()
+
+	submit := func(files ...string) map[string]string {
+		t.Helper()
+		body, _ := json.Marshal(MergeRequest{Files: files, Out: "pack 1"})
+		resp, err := http.Post(app.URL+"/merge", "application/json", bytes.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		var out map[string]string
+		_ = json.NewDecoder(resp.Body).Decode(&out)
+		if resp.StatusCode != http.StatusAccepted || out["events"] != "/jobs/"+out["job"]+"/events" {
+			t.Fatalf("POST /merge = %d %v", resp.StatusCode, out)
+		}
+		return out
+	}
+	stream := func(path string) []sseEvent {
+		t.Helper()
+		resp, err := http.Get(app.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+		if ct := resp.Header.Get("Content-Type"); resp.StatusCode != 200 || ct != "text/event-stream" {
+			t.Fatalf("GET %s = %d %s", path, resp.StatusCode, ct)
+		}
+		return readSSE(t, resp)
+	}
+
+	sub := submit(pdfs.URL+"/p1.pdf", pdfs.URL+"/bad.pdf", pdfs.URL+"/p2.pdf")
+	events := stream(sub["events"])
+	if len(events) < 2 {
+		t.Fatalf("got %d events, want progress events then done", len(events))
+	}
+	prevDone := 0
+	for i, ev := range events {
+		if want := tern(i == len(events)-1, "done", "progress"); ev.name != want {
+			t.Errorf("event %d = %q, want %q", i, ev.name, want)
+		}
+		if ev.job.ID != sub["job"] || ev.job.Done < prevDone {
+			t.Errorf("event %d: job %s done %d after %d", i, ev.job.ID, ev.job.Done, prevDone)
+		}
+		prevDone = ev.job.Done
+	}
+	final := events[len(events)-1].job
+	if final.State != "done" || final.Done != 3 || final.Download != "/download/pack1.pdf" || final.Finished == nil {
+		t.Errorf("final event = %+v", final)
+	}
+	if len(final.Skipped) != 1 || final.Files[1].State != "skipped" || final.Files[1].Error != "http 404" {
+		t.Errorf("skipped = %v, files = %+v; want bad.pdf skipped with http 404", final.Skipped, final.Files)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "pack1.pdf")); err != nil {
+		t.Error(err)
+	}
+
+	// stream mở sau khi job xong: chỉ một event done
+	if again := stream(sub["events"]); len(again) != 1 || again[0].name != "done" {
+		t.Errorf("events after finish = %+v, want a single done event", again)
+	}
+	resp, err := http.Get(app.URL + sub["status"])
+	if err != nil {
+		t.Fatal(err)
+	}
+	status := &mergeJob{}
+	_ = json.NewDecoder(resp.Body).Decode(status)
+	resp.Body.Close()
+	if status.State != "done" || status.Download != final.Download {
+		t.Errorf("GET %s = %+v", sub["status"], status)
+	}
+
+	// không đủ 2 PDF hợp lệ: job failed, stream vẫn kết thúc bằng done
+	failed := stream(submit(pdfs.URL+"/bad.pdf", pdfs.URL+"/p3.pdf")["events"])
+	if last := failed[len(failed)-1]; last.name != "done" || last.job.State != "failed" || last.job.Error == "" {
+		t.Errorf("failed job last event = %+v", last)
+	}
+
+	for _, path := range []string{"/jobs/nope", "/jobs/nope/events"} {
+		resp, err := http.Get(app.URL + path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != http.StatusNotFound {
+			t.Errorf("GET %s = %d, want 404", path, resp.StatusCode)
+		}
+	}
+	resp, err = http.Post(app.URL+"/merge", "application/json", strings.NewReader(`{"files":["`+pdfs.URL+`/p1.pdf"]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusBadRequest {
+		t.Errorf("POST /merge with one file = %d, want 400", resp.StatusCode)
+	}
+}
+
+// Có mirror: job đầu tải từ origin và lưu vào mirror, job sau lấy thẳng từ
+// mirror (state cached) mà không gọi origin, không chờ slot của host.
+func TestMergeJobMirror(t *testing.T) {
+	var host, all concurrency
+	pdfs := newPDFServer(t, 0, nil, &host, &all)
+
+	mirror, err := openMirror(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	q := newMergeQueue(ctx, 1, t.TempDir(), mirror, mergeOptions{Concurrency: 2, PerHost: 1})
+	files := []string{pdfs.URL + "/m1.pdf", pdfs.URL + "/m2.pdf"}
+
+	for i, want := range []string{"done", "cached"} {
+		j, err := q.submit(files, fmt.Sprintf("m%d.pdf", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := waitJob(t, j)
+		if got.State != "done" {
+			t.Fatalf("job %d: state %s error %q", i, got.State, got.Error)
+		}
+		for _, f := range got.Files {
+			if f.State != want {
+				t.Errorf("job %d: %s state %s, want %s", i, f.URL, f.State, want)
+			}
+		}
+	}
+	if got := host.count(); got != 2 {
+		t.Errorf("origin hits = %d, want 2 (second job served from the mirror)", got)
+	}
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+)
+
+// kvStore: store nhúng dạng log append-only (file .db hoặc -store kv).
+// Dòng đầu là header, mỗi dòng sau là một bản ghi item JSON với khoá là
+// pdf_url; bản ghi sau thắng. Index khoá -> offset nằm trong RAM (dựng lại
+// khi mở) nên Append/Upsert không phải đọc lại file; Close compact khi
+// bản ghi cũ chiếm quá nửa file.
+type kvStore struct {
+	path  string
+	f     *os.File // chỉ mở khi ghi lần đầu; đọc thì dùng file riêng
+	size  int64    // cuối bản ghi hoàn chỉnh cuối cùng
+	index map[string]kvRef
+	order []string // khoá theo thứ tự thêm lần đầu
+	dead  int      // số bản ghi đã bị bản sau thay
+}
+
+type kvRef struct {
+	off int64
+	n   int
+}
+
+const kvHeader = `{"worksheet_store":"kv","version":1}`
+
+func openKVStore(path string) (*kvStore, error) {
+	s := &kvStore{path: path, index: map[string]kvRef{}}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReaderSize(f, 64*1024)
+	var off int64
+	first := true
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			// dòng cuối không có \n = đang ghi dở (hoặc crash); bỏ qua
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+		n := len(line)
+		if first {
+			if string(bytes.TrimSpace(line)) != kvHeader {
+				return nil, fmt.Errorf("%s: not a kv item store", path)
+			}
+			first = false
+			off += int64(n)
+			continue
+		}
+		var it Item
+		if err := json.Unmarshal(line, &it); err != nil {
+			return nil, fmt.Errorf("%s at offset %d: %w", path, off, err)
+		}
+		s.put(itemKey(it), kvRef{off: off, n: n})
+		off += int64(n)
+	}
+	s.size = off
+	return s, nil
+}
+
+func (s *kvStore) put(key string, ref kvRef) {
+	if _, ok := s.index[key]; ok {
+		s.dead++
+	} else {
+		s.order = append(s.order, key)
+	}
+	s.index[key] = ref
+}
+
+func (s *kvStore) Load() ([]Item, error) {
+	if len(s.index) == 0 {
+		return nil, nil
+	}
+	f, err := os.Open(s.path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	// đọc tuần tự một lượt, chỉ giữ bản ghi mà index đang trỏ tới
+	live := make(map[string]Item, len(s.index))
+	r := bufio.NewReaderSize(f, 64*1024)
+	var off int64
+	for off < s.size {
+		line, err := r.ReadBytes('\n')
+		if err != nil {
+			return nil, err
+		}
+		if off > 0 {
+			var it Item
+			if err := json.Unmarshal(line, &it); err != nil {
+				return nil, err
+			}
+			if ref, ok := s.index[itemKey(it)]; ok && ref.off == off {
+				live[itemKey(it)] = it
+			}
+		}
+		off += int64(len(line))
+	}
+	items := make([]Item, 0, len(s.order))
+	for _, k := range s.order {
+		if it, ok := live[k]; ok {
+			items = append(items, it)
+		}
+	}
+	return items, nil
+}
+
+func (s *kvStore) Iterate(fn func(Item) error) error {
+	items, err := s.Load()
+	return iterateSlice(items, err, fn)
+}
+
+// Append = Upsert: khoá là duy nhất nên item cùng pdf_url thay bản cũ.
+func (s *kvStore) Append(items ...Item) error { return s.Upsert(items...) }
+
+func (s *kvStore) Upsert(items ...Item) error {
+	if len(items) == 0 {
+		return nil
+	}
+	if err := s.openWriter(); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	refs := make([]kvRef, 0, len(items))
+	keys := make([]string, 0, len(items))
+	for _, it := range items {
+		key := itemKey(it)
+		if key == "" {
+			continue
+		}
+		b, err := json.Marshal(it)
+		if err != nil {
+			return err
+		}
+		refs = append(refs, kvRef{off: s.size + int64(buf.Len()), n: len(b) + 1})
+		keys = append(keys, key)
+		buf.Write(b)
+		buf.WriteByte('\n')
+	}
+	if _, err := s.f.WriteAt(buf.Bytes(), s.size); err != nil {
+		return err
+	}
+	s.size += int64(buf.Len())
+	for i, k := range keys {
+		s.put(k, refs[i])
+	}
+	return nil
+}
+
+func (s *kvStore) openWriter() error {
+	if s.f != nil {
+		return nil
+	}
+	f, err := os.OpenFile(s.path, os.O_CREATE|os.O_RDWR, 0o644)
+	if err != nil {
+		return err
+	}
+	if s.size == 0 {
+		if _, err := f.WriteAt([]byte(kvHeader+"\n"), 0); err != nil {
+			f.Close()
+			return err
+		}
+		s.size = int64(len(kvHeader) + 1)
+	}
+	// cắt dòng ghi dở (nếu có) trước khi append tiếp
+	if err := f.Truncate(s.size); err != nil {
+		f.Close()
+		return err
+	}
+	s.f = f
+	return nil
+}
+
+func (s *kvStore) Close() error {
+	if s.f == nil {
+		return nil
+	}
+	err := s.f.Close()
+	s.f = nil
+	if err == nil && s.dead > 0 && s.dead > len(s.index) {
+		err = s.compact()
+	}
+	return err
+}
+
+// compact ghi lại file chỉ với bản ghi mới nhất của mỗi khoá.
+func (s *kvStore) compact() error {
+	items, err := s.Load()
+	if err != nil {
+		return err
+	}
+	tmp := s.path + ".tmp"
+	if err := writeKV(tmp, items); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, s.path); err != nil {
+		return err
+	}
+	fresh, err := openKVStore(s.path)
+	if err != nil {
+		return err
+	}
+	*s = *fresh
+	return nil
+}
+
+// writeKV ghi mới một file kv (dùng cho writeItemsAtomic).
+func writeKV(path string, items []Item) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	if _, err := w.WriteString(kvHeader + "\n"); err != nil {
+		return err
+	}
+	enc := json.NewEncoder(w)
+	for _, it := range items {
+		if itemKey(it) == "" {
+			continue
+		}
+		if err := enc.Encode(it); err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
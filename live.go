@@ -0,0 +1,167 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// liveItems: watcher đọc lại các file data khi mtime/size của một file đổi
+// (crawl append batch, resolve/migrate ghi lại, sửa tay) và thay view của
+// Catalog một lần bằng item của mọi file, request đang chạy vẫn giữ view cũ.
+type liveItems struct {
+	paths []string
+	cat   *Catalog
+
+	// chỉ goroutine watch dùng
+	stamps map[string]fileStamp
+}
+
+// fileStamp: mtime + size lần đọc trước của một file data.
+type fileStamp struct {
+	modTime time.Time
+	size    int64
+}
+
+func newLiveItems(cat *Catalog, paths ...string) *liveItems {
+	return &liveItems{paths: uniq(paths), cat: cat, stamps: map[string]fileStamp{}}
+}
+
+// reload đọc lại mọi file nếu có file đổi, mới xuất hiện hoặc bị xoá; file
+// chưa có (crawl chưa ghi) không góp item nào.
+func (l *liveItems) reload() (bool, error) {
+	stamps := make(map[string]fileStamp, len(l.paths))
+	for _, p := range l.paths {
+		st, err := os.Stat(p)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return false, err
+		}
+		stamps[p] = fileStamp{st.ModTime(), st.Size()}
+	}
+	if maps.EqualFunc(stamps, l.stamps, func(a, b fileStamp) bool {
+		return a.modTime.Equal(b.modTime) && a.size == b.size
+	}) {
+		return false, nil
+	}
+	var items []Item
+	for _, p := range l.paths {
+		if _, ok := stamps[p]; !ok {
+			continue
+		}
+		its, err := loadItems(p)
+		if err != nil {
+			// thường là đang ghi dở dòng cuối; lần poll sau đọc lại
+			return false, fmt.Errorf("%s: %w", p, err)
+		}
+		items = append(items, its...)
+	}
+	l.stamps = stamps
+	l.cat.Replace(items)
+	return true, nil
+}
+
+// watch poll các file data mỗi interval tới khi ctx bị huỷ.
+func (l *liveItems) watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+		changed, err := l.reload()
+		switch {
+		case err != nil:
+			log.Printf("[reload] %v", err)
+		case changed:
+			v := l.cat.View()
+			log.Printf("[reload] %s: %d items (v%d)", strings.Join(l.paths, ", "), v.Len(), v.version)
+		}
+	}
+}
+
+// crawlProgress: tiến độ một source, engine báo qua CrawlConfig.Progress.
+type crawlProgress struct {
+	Source     string `json:"source"`
+	Page       int    `json:"page,omitempty"`
+	Collected  int    `json:"collected"`
+	Failed     int    `json:"failed"`
+	Disallowed int    `json:"disallowed"`
+}
+
+// crawlStatus: trạng thái crawl nền cho /status.
+type crawlStatus struct {
+	mu       sync.Mutex
+	State    string          `json:"state"` // idle | running | done | stopped
+	Current  *crawlProgress  `json:"current,omitempty"`
+	Done     []crawlProgress `json:"done,omitempty"`
+	Started  *time.Time      `json:"started,omitempty"`
+	Finished *time.Time      `json:"finished,omitempty"`
+	LastErr  string          `json:"last_error,omitempty"`
+}
+
+func (s *crawlStatus) start() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.State, s.Started = "running", &now
+}
+
+func (s *crawlStatus) progress(p crawlProgress) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Current = &p
+}
+
+// sourceDone chuyển tiến độ cuối của source vào Done.
+func (s *crawlStatus) sourceDone(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Current != nil {
+		s.Done = append(s.Done, *s.Current)
+		s.Current = nil
+	}
+	if err != nil {
+		s.LastErr = err.Error()
+	}
+}
+
+func (s *crawlStatus) finish(stopped bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now()
+	s.State, s.Finished = tern(stopped, "stopped", "done"), &now
+}
+
+// handleStatus: JSON cho chỉ báo trạng thái trên trang index.
+func handleStatus(cat *Catalog, cs *crawlStatus) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		view := cat.View()
+		cs.mu.Lock()
+		body, err := json.Marshal(map[string]any{
+			"crawl":     cs,
+			"items":     view.Len(),
+			"version":   view.version,
+			"loaded_at": view.loadedAt,
+		})
+		cs.mu.Unlock()
+		if err != nil {
+			http.Error(w, `{"error":"status"}`, http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		_, _ = w.Write(body)
+	}
+}
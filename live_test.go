@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func liveTitles(cat *Catalog) string {
+	var titles []string
+	for _, it := range cat.View().Items() {
+		titles = append(titles, it.Title)
+	}
+	return strings.Join(titles, ",")
+}
+
+// Catalog gồm item của mọi file data (-data, -wsf_data, ...); file nào đổi,
+// mới có hay bị xoá thì nạp lại cả catalog.
+func TestLiveItemsReloadsEveryFile(t *testing.T) {
+	dir := t.TempDir()
+	kiddo, wsf := filepath.Join(dir, "items.jsonl"), filepath.Join(dir, "wsfun_items.jsonl")
+	if err := writeJSONL(kiddo, []Item{{Title: "A", PDFURL: "https://k/a.pdf"}}); err != nil {
+		t.Fatal(err)
+	}
+	cat := newCatalog(nil)
+	live := newLiveItems(cat, kiddo, wsf, kiddo)
+
+	steps := []struct {
+		name    string
+		change  func() error
+		changed bool
+		want    string
+	}{
+		{"first load, second file missing", nil, true, "A"},
+		{"nothing changed", nil, false, "A"},
+		{"second file appears", func() error {
+			return writeJSONL(wsf, []Item{{Title: "W1", PDFURL: "https://w/1.pdf"}})
+		}, true, "A,W1"},
+		{"second file grows", func() error {
+			return writeJSONL(wsf, []Item{{Title: "W1", PDFURL: "https://w/1.pdf"}, {Title: "W2", PDFURL: "https://w/2.pdf"}})
+		}, true, "A,W1,W2"},
+		{"same pdf in both files is one item", func() error {
+			return writeJSONL(kiddo, []Item{{Title: "A", PDFURL: "https://k/a.pdf"}, {Title: "B", PDFURL: "https://w/2.pdf"}})
+		}, true, "A,B,W1"},
+		{"second file removed", func() error { return os.Remove(wsf) }, true, "A,B"},
+	}
+	for _, st := range steps {
+		if st.change != nil {
+			if err := st.change(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		changed, err := live.reload()
+		if err != nil {
+			t.Fatalf("%s: %v", st.name, err)
+		}
+		if changed != st.changed || liveTitles(cat) != st.want {
+			t.Errorf("%s: changed = %v, items %s; want %v, %s", st.name, changed, liveTitles(cat), st.changed, st.want)
+		}
+	}
+
+	// file hỏng (đang ghi dở): báo lỗi, giữ catalog cũ, lần sau đọc lại
+	v := cat.View().version
+	if err := os.WriteFile(wsf, []byte(`{"title":"W3","pdf_url":"https://w/3.pdf"}`+"\n{\"title\":"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := live.reload(); err == nil || !strings.Contains(err.Error(), wsf) || cat.View().version != v {
+		t.Errorf("broken file: err = %v, version %d (was %d)", err, cat.View().version, v)
+	}
+	if err := writeJSONL(wsf, []Item{{Title: "W3", PDFURL: "https://w/3.pdf"}}); err != nil {
+		t.Fatal(err)
+	}
+	if changed, err := live.reload(); err != nil || !changed || liveTitles(cat) != "A,B,W3" {
+		t.Errorf("after fixing the file: changed = %v, err = %v, items %s", changed, err, liveTitles(cat))
+	}
+}
+
+func TestLiveItemsWatch(t *testing.T) {
+	dir := t.TempDir()
+	wsf := filepath.Join(dir, "wsfun_items.jsonl")
+	cat := newCatalog(nil)
+	live := newLiveItems(cat, filepath.Join(dir, "items.jsonl"), wsf)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go live.watch(ctx, 10*time.Millisecond)
+
+	if err := writeJSONL(wsf, []Item{{Title: "W1", PDFURL: "https://w/1.pdf"}}); err != nil {
+		t.Fatal(err)
+	}
+	for deadline := time.Now().Add(5 * time.Second); liveTitles(cat) != "W1"; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatalf("catalog not reloaded from %s: items %q", wsf, liveTitles(cat))
+		}
+	}
+}
+
+// started/finished chỉ có trong JSON khi đã đặt (omitempty không bỏ được time.Time rỗng).
+func TestCrawlStatusJSON(t *testing.T) {
+	cs := &crawlStatus{State: "idle"}
+	keys := func() map[string]any {
+		t.Helper()
+		b, err := json.Marshal(cs)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var m map[string]any
+		if err := json.Unmarshal(b, &m); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	if m := keys(); m["started"] != nil || m["finished"] != nil {
+		t.Errorf("idle status = %v, want no started/finished", m)
+	}
+	cs.start()
+	if m := keys(); m["started"] == nil || m["finished"] != nil || m["state"] != "running" {
+		t.Errorf("running status = %v", m)
+	}
+	cs.finish(true)
+	if m := keys(); m["started"] == nil || m["finished"] == nil || m["state"] != "stopped" {
+		t.Errorf("stopped status = %v", m)
+	}
+}
@@ -1,71 +1,192 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
 )
 
 var (
 	// UI flags
-	dataPath = flag.String("data", defaultData, "path to data file (JSON array or JSONL) with fields: title,pdf_url,img_url")
-	addrFlag = flag.String("addr", defaultAddr, "http listen address, e.g. :8080")
-	outDir   = flag.String("out", defaultOut, "output directory for merged PDFs")
+	dataPath      = flag.String("data", defaultData, "path to data file (JSON array, JSONL or .db kv store) with fields: title,pdf_url,img_url")
+	storeFlag     = flag.String("store", "", "item store format for data files: jsonl, json (array) or kv (embedded indexed store); empty = by extension (.jsonl, .db = kv, else json)")
+	addrFlag      = flag.String("addr", defaultAddr, "http listen address, e.g. :8080")
+	outDir        = flag.String("out", defaultOut, "output directory for merged PDFs")
+	mergeWorkers  = flag.Int("merge_workers", 2, "merge jobs processed concurrently (POST /merge queues a job)")
+	mergeConc     = flag.Int("merge_concurrency", 4, "PDFs downloaded in parallel within one merge job (page order is kept)")
+	mergePerHost  = flag.Int("merge_per_host", 2, "max concurrent PDF downloads from the same host across all merge jobs")
+	mergeFileTO   = flag.Duration("merge_file_timeout", 60*time.Second, "timeout per PDF download in a merge, including retries (0 = none)")
+	mergeDeadline = flag.Duration("merge_deadline", 10*time.Minute, "overall deadline for downloading a merge job's PDFs (0 = none)")
 
 	// Crawl-on-start flags
-	autoCrawl   = flag.Bool("crawl", true, "run crawler before starting UI")
-	cpPath      = flag.String("cp", "kiddo.checkpoint.json", "checkpoint file to resume crawl")
-	startPage   = flag.Int("start", 1, "start page number (used if no checkpoint yet)")
-	endPage     = flag.Int("end", 0, "end page number (0 = auto detect)")
-	delayMs     = flag.Int("delay", 1200, "delay between requests in milliseconds")
-	maxItemsRun = flag.Int("max", 0, "max items to collect this run (0 = unlimited)")
+	autoCrawl    = flag.Bool("crawl", true, "run crawler before starting UI")
+	sitesDir     = flag.String("sites", "", "directory of JSON site definitions to register as sources (same name overrides a built-in source), e.g. sites")
+	sourcesFlag  = flag.String("sources", "", "comma-separated sources to crawl before starting UI, e.g. kiddo,wsfun (empty = derive from -crawl/-crawl_wsfun)")
+	cpPath       = flag.String("cp", "kiddo.checkpoint.json", "checkpoint file to resume crawl")
+	startPage    = flag.Int("start", 1, "start page number (used if no checkpoint yet)")
+	endPage      = flag.Int("end", 0, "end page number (0 = auto detect)")
+	delayMs      = flag.Int("delay", 1200, "min delay between requests to the same host in milliseconds (used when -rate = 0)")
+	maxItemsRun  = flag.Int("max", 0, "max items to collect this run (0 = unlimited)")
+	workers      = flag.Int("workers", 4, "concurrent detail-page fetches per crawl")
+	ratePerSec   = flag.Float64("rate", 0, "max requests/second per host (0 = derive from -delay)")
+	burst        = flag.Int("burst", 1, "requests allowed to burst per host above -rate")
+	cacheDir     = flag.String("cache_dir", "", "on-disk HTTP cache for crawl fetches (empty = disabled)")
+	cacheMaxAge  = flag.Duration("cache_max_age", 0, "serve cached pages younger than this without contacting the server (0 = always revalidate)")
+	refresh      = flag.Bool("refresh", false, "ignore the HTTP cache and re-download every page")
+	incremental  = flag.Bool("incremental", false, "only pick up new items: walk from page 1 and stop after -incr_stop fully-known list pages (checkpoint untouched)")
+	incrStop     = flag.Int("incr_stop", 3, "consecutive list pages with only known detail URLs before an incremental crawl stops")
+	retries      = flag.Int("retries", 2, "retries per HTTP request on network errors, 429 and 5xx (crawl and PDF downloads)")
+	discover     = flag.String("discover", "list", "how to find detail pages: list (paginated list pages) or sitemap (sitemap.xml, uses lastmod to skip unchanged pages)")
+	sitemapURL   = flag.String("sitemap", "", "override the source's sitemap URL when -discover=sitemap")
+	resolveMode  = flag.String("resolve", "", "after crawling, resolve pdf_url values that are HTML pages into direct PDF links: new (unchecked items) or all (also retry unresolved); empty = off")
+	subjectMapF  = flag.String("subject_map", "", "JSON file with extra subject aliases/strip_prefixes/drop merged into the built-in subject table")
+	migrateSubj  = flag.String("migrate_subjects", "", "comma-separated data files to rewrite with normalized subject + tags, then exit")
+	verifyData   = flag.String("verify", "", "audit a data file: check every pdf_url/img_url/detail_url, write a report, then exit")
+	verifyOut    = flag.String("verify_report", "verify_report", "report path without extension for -verify (writes .json and .txt)")
+	verifyPrune  = flag.String("verify_prune", "", "with -verify, also write a catalog without items whose pdf_url is broken")
+	dedupIn      = flag.String("dedup", "", "comma-separated data files to combine and deduplicate by PDF content (SHA-256), writing -dedup_out, then exit")
+	dedupOut     = flag.String("dedup_out", "items.jsonl", "output data file for -dedup")
+	mirrorDir    = flag.String("mirror_dir", "", "local content-addressed PDF store; /merge and -dedup read from it first and save new downloads into it (empty = disabled)")
+	mirrorRun    = flag.Bool("mirror", false, "download every PDF of -data into -mirror_dir, then exit")
+	thumbDir     = flag.String("thumb_dir", "", "where /thumb stores downloaded img_url images and resized thumbnails (empty = UI hot-links img_url)")
+	mirrorThumbs = flag.Bool("mirror_thumbs", false, "download every img_url of -data into -thumb_dir and pre-render card thumbnails, then exit")
+	recordDir    = flag.String("record", "", "save every crawl response into this fixtures directory (for offline replay)")
+	replayDir    = flag.String("replay", "", "serve crawl requests from a fixtures directory recorded with -record instead of the network")
+	crawlTimeout = flag.Duration("crawl_timeout", 0, "overall deadline for the background crawl, e.g. 30m (0 = none); progress is saved when it expires")
+	reloadEvery  = flag.Duration("reload_every", 5*time.Second, "how often the UI checks the data files (-data, -wsf_data, crawled sources) for changes and reloads the catalog")
+	maxAttempts  = flag.Int("max_attempts", 5, "give up on a failed list page or detail URL from the checkpoint after this many attempts")
+
+	// crawlFetcher: Fetcher thay cho mạng khi chạy -replay (nil = HTTP thật)
+	crawlFetcher Fetcher
 
 	crawlWSF = flag.Bool("crawl_wsfun", false, "also crawl worksheetfun.com before starting UI")
-	wsfData  = flag.String("wsf_data", "wsfun_items.jsonl", "output for worksheetfun items")
+	wsfData  = flag.String("wsf_data", "wsfun_items.jsonl", "output for worksheetfun items (also loaded into the UI)")
 	wsfCP    = flag.String("wsf_cp", "wsfun.checkpoint.json", "checkpoint file for worksheetfun crawl")
 	wsfCat   = flag.String("wsf_cat", "", "WorksheetFun category URL to crawl (e.g. https://www.worksheetfun.com/category/.../page/1)")
 )
 
 func main() {
 	flag.Parse()
+	pdfRetryPolicy = withRetries(*retries)
+	switch *storeFlag {
+	case "", "jsonl", "json", "kv":
+		storeFormat = *storeFlag
+	default:
+		log.Fatalf("unknown -store %q (want jsonl, json or kv)", *storeFlag)
+	}
 
-	// 1) (Optional) Run crawler with checkpoint
-	if *autoCrawl {
-		if err := RunCrawlerWithCheckpoint(CrawlConfig{
-			DataPath:  *dataPath,
-			CPPath:    *cpPath,
-			StartPage: *startPage,
-			EndPage:   *endPage,
-			DelayMs:   *delayMs,
-			MaxItems:  *maxItemsRun,
-			UserAgent: userAgent, // từ crawler
-		}); err != nil {
-			log.Printf("[crawl] warning: %v", err)
+	if *subjectMapF != "" {
+		if err := loadSubjectMap(*subjectMapF); err != nil {
+			log.Fatalf("load subject map: %v", err)
+		}
+	}
+	if *migrateSubj != "" {
+		for _, p := range strings.Split(*migrateSubj, ",") {
+			if p = strings.TrimSpace(p); p == "" {
+				continue
+			}
+			if err := migrateSubjects(p); err != nil {
+				log.Fatalf("migrate subjects %s: %v", p, err)
+			}
 		}
+		return
 	}
 
-	if *crawlWSF {
-		if err := RunWSFunCrawlerWithCheckpoint(WSFCrawlConfig{
-			DataPath:        *wsfData,
-			CPPath:          *wsfCP,
-			StartPage:       1, // sẽ bị override bởi checkpoint nếu có
-			EndPage:         0, // auto detect
-			DelayMs:         *delayMs,
-			MaxItems:        *maxItemsRun,
-			BaseCategoryURL: *wsfCat,
-		}); err != nil {
-			log.Printf("[wsfun] warning: %v", err)
-		}
-	}
-
-	// 2) Load items for UI
-	items, err := loadItems(*dataPath)
-	if err != nil {
+	if *verifyData != "" {
+		if err := VerifyCatalog(*verifyData, *verifyOut, *verifyPrune, downloadClientConfig()); err != nil {
+			log.Fatalf("verify %s: %v", *verifyData, err)
+		}
+		return
+	}
+
+	var mirror *pdfMirror
+	if *mirrorDir != "" {
+		var err error
+		if mirror, err = openMirror(*mirrorDir); err != nil {
+			log.Fatalf("open mirror %s: %v", *mirrorDir, err)
+		}
+	}
+	if *mirrorRun {
+		if mirror == nil {
+			log.Fatal("-mirror needs -mirror_dir")
+		}
+		if err := MirrorCatalog(*dataPath, mirror, downloadClientConfig()); err != nil {
+			log.Fatalf("mirror %s: %v", *dataPath, err)
+		}
+		return
+	}
+
+	if *mirrorThumbs {
+		if *thumbDir == "" {
+			log.Fatal("-mirror_thumbs needs -thumb_dir")
+		}
+		cfg := downloadClientConfig()
+		client, _ := newCrawlClient(cfg)
+		store, err := newThumbStore(*thumbDir, client)
+		if err != nil {
+			log.Fatalf("open thumb dir %s: %v", *thumbDir, err)
+		}
+		if err := MirrorThumbs(*dataPath, store, thumbDefaultWidth, cfg.Workers); err != nil {
+			log.Fatalf("mirror thumbs %s: %v", *dataPath, err)
+		}
+		return
+	}
+
+	if *dedupIn != "" {
+		var paths []string
+		for _, p := range strings.Split(*dedupIn, ",") {
+			if p = strings.TrimSpace(p); p != "" {
+				paths = append(paths, p)
+			}
+		}
+		if err := DedupByContent(paths, *dedupOut, mirror, downloadClientConfig()); err != nil {
+			log.Fatalf("dedup: %v", err)
+		}
+		return
+	}
+
+	if *replayDir != "" {
+		f, err := newReplayFetcher(*replayDir)
+		if err != nil {
+			log.Fatalf("replay fixtures: %v", err)
+		}
+		crawlFetcher = f
+	}
+
+	if *sitesDir != "" {
+		if err := loadSiteDefs(*sitesDir); err != nil {
+			log.Fatalf("load site definitions: %v", err)
+		}
+	}
+
+	// Ctrl-C / SIGTERM: dừng crawl nền gọn (ghi batch + checkpoint) rồi tắt server.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// 1) Catalog cho UI: nạp ngay, watcher nạp lại khi file data đổi
+	cat := newCatalog(nil)
+	live := newLiveItems(cat, catalogPaths()...)
+	if _, err := live.reload(); err != nil {
 		log.Fatalf("load items: %v", err)
 	}
-	if len(items) == 0 {
-		log.Printf("Warning: no items found in %s", *dataPath)
+	if cat.View().Len() == 0 {
+		log.Printf("Warning: no items found in %s (yet)", strings.Join(live.paths, ", "))
 	}
+	go live.watch(ctx, *reloadEvery)
+
+	// 2) (Optional) Crawl nền cho từng source được chọn, UI vẫn phục vụ song song
+	status := &crawlStatus{State: "idle"}
+	crawlDone := make(chan struct{})
+	go func() {
+		defer close(crawlDone)
+		runCrawls(ctx, status)
+	}()
 
 	// 3) Ensure output dir
 	if err := osMkdirAll(*outDir, 0o755); err != nil {
@@ -73,10 +194,177 @@ func main() {
 	}
 
 	// 4) Routes (UI)
-	http.HandleFunc("/", handleIndex(items, *outDir))
-	http.HandleFunc("/merge", handleMerge(*outDir))
+	http.HandleFunc("/", handleIndex(cat, *outDir, *thumbDir != ""))
+	if *thumbDir != "" {
+		store, err := newThumbStore(*thumbDir, newRetryClient(nil, pdfRetryPolicy, 30*time.Second))
+		if err != nil {
+			log.Fatalf("open thumb dir %s: %v", *thumbDir, err)
+		}
+		http.HandleFunc("/thumb", handleThumb(cat, store))
+	}
+	http.HandleFunc("/status", handleStatus(cat, status))
+	http.HandleFunc("GET /api/items", handleAPIItems(cat))
+	http.HandleFunc("GET /api/items/{id}", handleAPIItem(cat))
+	http.HandleFunc("GET /api/subjects", handleAPISubjects(cat))
+	mq := newMergeQueue(ctx, *mergeWorkers, *outDir, mirror, mergeOptions{
+		Concurrency: *mergeConc,
+		PerHost:     *mergePerHost,
+		FileTimeout: *mergeFileTO,
+		Deadline:    *mergeDeadline,
+	})
+	http.HandleFunc("POST /merge", handleMerge(mq))
+	http.HandleFunc("GET /jobs/{id}", handleJob(mq))
+	http.HandleFunc("GET /jobs/{id}/events", handleJobEvents(mq))
 	http.Handle("/download/", http.StripPrefix("/download/", http.FileServer(http.Dir(*outDir))))
 
-	log.Printf("UI: http://localhost%s  | data=%s  | out=%s  | crawl=%v", *addrFlag, *dataPath, *outDir, *autoCrawl)
-	log.Fatal(http.ListenAndServe(*addrFlag, nil))
+	srv := &http.Server{Addr: *addrFlag}
+	go func() {
+		<-ctx.Done()
+		stop() // Ctrl-C lần nữa thì thoát ngay
+		log.Printf("shutting down: waiting for the crawl to save progress (Ctrl-C again to force)")
+		<-crawlDone // đợi crawl ghi xong batch + checkpoint
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		_ = srv.Shutdown(shutdownCtx)
+	}()
+
+	log.Printf("UI: http://localhost%s  | data=%s  | out=%s  | sources=%v", *addrFlag, strings.Join(live.paths, ","), *outDir, selectedSources())
+	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-crawlDone
+}
+
+// runCrawls chạy lần lượt các source được chọn (và -resolve nếu bật),
+// cập nhật status cho /status. -crawl_timeout giới hạn tổng thời gian.
+func runCrawls(ctx context.Context, status *crawlStatus) {
+	names := selectedSources()
+	if len(names) == 0 && *resolveMode == "" {
+		return
+	}
+	if *crawlTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, *crawlTimeout)
+		defer cancel()
+	}
+	status.start()
+
+	resolved := map[string]bool{}
+	for _, name := range names {
+		if ctx.Err() != nil {
+			log.Printf("[crawl] skip %s: %v", name, ctx.Err())
+			continue
+		}
+		listURL, cfg := sourceCrawlConfig(name)
+		cfg.Progress = status.progress
+		src, err := newSource(name, listURL)
+		if err != nil {
+			log.Printf("[crawl] %v", err)
+			status.sourceDone(err)
+			continue
+		}
+		err = RunCrawl(ctx, src, cfg)
+		if err != nil {
+			log.Printf("[%s] warning: %v", name, err)
+		}
+		status.sourceDone(err)
+		if *resolveMode != "" && ctx.Err() == nil {
+			resolveData(ctx, cfg.DataPath, src.UserAgent())
+			resolved[cfg.DataPath] = true
+		}
+	}
+	// -resolve không kèm crawl: resolve file data của UI
+	if *resolveMode != "" && !resolved[*dataPath] && ctx.Err() == nil {
+		resolveData(ctx, *dataPath, "")
+	}
+	status.finish(ctx.Err() != nil)
+}
+
+func resolveData(ctx context.Context, path, ua string) {
+	if err := ResolvePDFURLs(ctx, path, ua, downloadClientConfig(), *resolveMode == "all"); err != nil {
+		log.Printf("[resolve] %s: warning: %v", path, err)
+	}
+}
+
+// catalogPaths: các file data UI nạp và theo dõi: -data, -wsf_data và file
+// data của mọi source được chọn để crawl nền.
+func catalogPaths() []string {
+	paths := []string{*dataPath, *wsfData}
+	for _, name := range selectedSources() {
+		_, cfg := sourceCrawlConfig(name)
+		paths = append(paths, cfg.DataPath)
+	}
+	return uniq(paths)
+}
+
+// selectedSources: -sources nếu có, nếu không thì suy từ flag cũ -crawl/-crawl_wsfun.
+func selectedSources() []string {
+	var names []string
+	if strings.TrimSpace(*sourcesFlag) != "" {
+		for _, n := range strings.Split(*sourcesFlag, ",") {
+			if n = strings.ToLower(strings.TrimSpace(n)); n != "" {
+				names = append(names, n)
+			}
+		}
+		return uniq(names)
+	}
+	if *autoCrawl {
+		names = append(names, "kiddo")
+	}
+	if *crawlWSF {
+		names = append(names, "wsfun")
+	}
+	return names
+}
+
+// sourceCrawlConfig: map flags sang CrawlConfig của từng source.
+// Source mới mặc định ghi ra <name>_items.jsonl và <name>.checkpoint.json.
+func sourceCrawlConfig(name string) (listURL string, cfg CrawlConfig) {
+	cfg = CrawlConfig{
+		DataPath:  name + "_items.jsonl",
+		CPPath:    name + ".checkpoint.json",
+		StartPage: *startPage,
+		EndPage:   *endPage,
+		DelayMs:   *delayMs,
+		MaxItems:  *maxItemsRun,
+		Retry:     *retries,
+
+		Workers:    *workers,
+		RatePerSec: *ratePerSec,
+		Burst:      *burst,
+
+		CacheDir:     *cacheDir,
+		CacheMaxAge:  *cacheMaxAge,
+		CacheRefresh: *refresh,
+
+		Incremental:     *incremental,
+		IncrementalStop: *incrStop,
+		MaxAttempts:     *maxAttempts,
+
+		Discovery:  *discover,
+		SitemapURL: *sitemapURL,
+
+		Fetcher:   crawlFetcher,
+		RecordDir: *recordDir,
+	}
+	switch name {
+	case "kiddo":
+		cfg.DataPath, cfg.CPPath = *dataPath, *cpPath
+		cfg.UserAgent = userAgent
+	case "wsfun":
+		cfg.DataPath, cfg.CPPath = *wsfData, *wsfCP
+		cfg.StartPage = 1 // sẽ bị override bởi checkpoint nếu có
+		cfg.EndPage = 0   // auto detect
+		listURL = *wsfCat
+	}
+	return listURL, cfg
+}
+
+// downloadClientConfig: cấu hình client (rate/retry/workers theo flag) cho
+// các lệnh tải hàng loạt (resolve, verify, dedup, mirror). Không đi qua HTTP
+// cache của crawler vì phần lớn response là file PDF/ảnh.
+func downloadClientConfig() CrawlConfig {
+	_, cfg := sourceCrawlConfig("kiddo")
+	cfg.CacheDir = ""
+	return cfg
 }
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// pdfMirror: bản sao cục bộ của các PDF trong catalog, lưu theo nội dung
+// (objects/<2 hex đầu>/<sha256>.pdf) kèm index URL -> sha256. Nhiều URL
+// cùng nội dung (aliases) trỏ về một file; upstream xoá file thì vẫn merge được.
+type pdfMirror struct {
+	dir string
+
+	mu    sync.Mutex
+	index map[string]string // pdf_url -> sha256
+	dirty bool
+}
+
+// openMirror mở (hoặc tạo) mirror ở dir và nạp index.json nếu có.
+func openMirror(dir string) (*pdfMirror, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "objects"), 0o755); err != nil {
+		return nil, err
+	}
+	m := &pdfMirror{dir: dir, index: map[string]string{}}
+	b, err := os.ReadFile(m.indexPath())
+	switch {
+	case os.IsNotExist(err):
+	case err != nil:
+		return nil, err
+	default:
+		if err := json.Unmarshal(b, &m.index); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+func (m *pdfMirror) indexPath() string { return filepath.Join(m.dir, "index.json") }
+
+func (m *pdfMirror) objectPath(sum string) string {
+	return filepath.Join(m.dir, "objects", sum[:2], sum+".pdf")
+}
+
+// Lookup trả đường dẫn file và sha256 nếu URL đã có trong mirror (file còn trên đĩa).
+func (m *pdfMirror) Lookup(u string) (path, sum string, ok bool) {
+	m.mu.Lock()
+	sum = m.index[strings.TrimSpace(u)]
+	m.mu.Unlock()
+	if sum == "" {
+		return "", "", false
+	}
+	path = m.objectPath(sum)
+	if _, err := os.Stat(path); err != nil {
+		return "", "", false
+	}
+	return path, sum, true
+}
+
+// Link ghi nhận URL u có nội dung sum (ví dụ alias của một item đã tải).
+func (m *pdfMirror) Link(u, sum string) {
+	u = strings.TrimSpace(u)
+	if u == "" || sum == "" {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.index[u] != sum {
+		m.index[u] = sum
+		m.dirty = true
+	}
+}
+
+// Fetch tải u (theo luật của downloadPDF) vào mirror, trả đường dẫn object và sha256.
+func (m *pdfMirror) Fetch(client Fetcher, u string) (path, sum string, err error) {
+	tmp, err := os.CreateTemp(m.dir, "dl_*.pdf")
+	if err != nil {
+		return "", "", err
+	}
+	tmpPath := tmp.Name()
+	tmp.Close()
+	defer os.Remove(tmpPath)
+
+	if err := downloadPDFWith(client, u, tmpPath); err != nil {
+		return "", "", err
+	}
+	if sum, err = fileSHA256(tmpPath); err != nil {
+		return "", "", err
+	}
+	path = m.objectPath(sum)
+	if _, err := os.Stat(path); err != nil {
+		// object mới; đã có (URL khác cùng nội dung) thì bỏ bản vừa tải
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			return "", "", err
+		}
+		if err := os.Rename(tmpPath, path); err != nil {
+			return "", "", err
+		}
+	}
+	m.Link(u, sum)
+	return path, sum, nil
+}
+
+// Save ghi index.json nếu có thay đổi.
+func (m *pdfMirror) Save() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !m.dirty {
+		return nil
+	}
+	b, err := json.MarshalIndent(m.index, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(m.indexPath(), b); err != nil {
+		return err
+	}
+	m.dirty = false
+	return nil
+}
+
+func fileSHA256(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// MirrorCatalog tải mọi PDF của catalog (pdf_url + aliases) chưa có vào mirror.
+// Item đã có sha256 (từ -dedup) mà object tồn tại thì chỉ cần ghi index.
+func MirrorCatalog(dataPath string, m *pdfMirror, cfg CrawlConfig) error {
+	items, err := loadItems(dataPath)
+	if err != nil {
+		return err
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	client, _ := newCrawlClient(cfg)
+
+	var todo []Item
+	have := 0
+	for _, it := range items {
+		if strings.TrimSpace(it.PDFURL) == "" {
+			continue
+		}
+		if _, sum, ok := m.Lookup(it.PDFURL); ok {
+			mirrorLinkAliases(m, it, sum)
+			have++
+			continue
+		}
+		if it.SHA256 != "" {
+			if _, err := os.Stat(m.objectPath(it.SHA256)); err == nil {
+				m.Link(it.PDFURL, it.SHA256)
+				mirrorLinkAliases(m, it, it.SHA256)
+				have++
+				continue
+			}
+		}
+		todo = append(todo, it)
+	}
+	log.Printf("[mirror] %s: %d items, %d already mirrored, %d to download -> %s", dataPath, len(items), have, len(todo), m.dir)
+
+	var mu sync.Mutex
+	done, failed := 0, 0
+	_ = forEachParallel(context.Background(), len(todo), cfg.Workers, func(i int) {
+		it := todo[i]
+		_, sum, err := m.Fetch(client, it.PDFURL)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			log.Printf("  [mirror] %s -> %v", it.PDFURL, err)
+			failed++
+			return
+		}
+		mirrorLinkAliases(m, it, sum)
+		done++
+		if done%50 == 0 {
+			log.Printf("[mirror] %d/%d downloaded", done, len(todo))
+			if err := m.Save(); err != nil {
+				log.Printf("[mirror] save index: %v", err)
+			}
+		}
+	})
+
+	log.Printf("[mirror] done: %d downloaded, %d failed, %d already mirrored", done, failed, have)
+	return m.Save()
+}
+
+func mirrorLinkAliases(m *pdfMirror, it Item, sum string) {
+	for _, a := range it.Aliases {
+		m.Link(a, sum)
+	}
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"net/url"
+	"path"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// pdfLink: một link PDF trên trang chi tiết kèm anchor text.
+type pdfLink struct {
+	URL  string
+	Text string
+}
+
+// collectPDFLinks gom mọi link (khác nhau) có đuôi thuộc suffixes, theo thứ
+// tự xuất hiện. Không có link nào như vậy thì lấy anchor đầu tiên có text
+// chứa một trong words như trước (có thể là link tải có redirect).
+func collectPDFLinks(doc *goquery.Document, sel string, suffixes, words []string, abs func(string) string) []pdfLink {
+	var links []pdfLink
+	var fallback *pdfLink
+	seen := map[string]bool{}
+	doc.Find(sel).Each(func(_ int, a *goquery.Selection) {
+		h, _ := a.Attr("href")
+		if strings.TrimSpace(h) == "" {
+			return
+		}
+		u := abs(strings.TrimSpace(h))
+		l := strings.ToLower(u)
+		if i := strings.IndexAny(l, "?#"); i >= 0 {
+			l = l[:i]
+		}
+		txt := cleanText(a.Text())
+		if txt == "" {
+			txt, _ = a.Attr("title")
+		}
+		for _, suf := range suffixes {
+			if strings.HasSuffix(l, suf) {
+				if !seen[u] {
+					seen[u] = true
+					links = append(links, pdfLink{URL: u, Text: strings.TrimSpace(txt)})
+				}
+				return
+			}
+		}
+		if fallback == nil && containsAny(strings.ToLower(txt), words) {
+			fallback = &pdfLink{URL: u, Text: strings.TrimSpace(txt)}
+		}
+	})
+	if len(links) == 0 && fallback != nil {
+		links = append(links, *fallback)
+	}
+	return links
+}
+
+// pdfItems: một Item cho mỗi PDF, dùng chung img/subject/detail_url của base.
+// Trang chỉ có một PDF giữ title của trang; nhiều PDF thì title lấy từ
+// anchor text, anchor chung chung ("Download PDF") thì lấy từ tên file.
+// Không có PDF nào -> trả base với pdf_url rỗng (engine sẽ bỏ qua).
+func pdfItems(base Item, links []pdfLink) []Item {
+	switch len(links) {
+	case 0:
+		return []Item{base}
+	case 1:
+		base.PDFURL = links[0].URL
+		return []Item{base}
+	}
+	out := make([]Item, 0, len(links))
+	for _, l := range links {
+		it := base
+		it.PDFURL = l.URL
+		if isGenericLinkText(l.Text) {
+			it.Title = pdfFileTitle(l.URL)
+		} else {
+			it.Title = l.Text
+		}
+		if it.Title == "" {
+			it.Title = base.Title
+		}
+		out = append(out, it)
+	}
+	return out
+}
+
+var genericLinkWords = map[string]bool{
+	"download": true, "downloads": true, "pdf": true, "free": true, "here": true,
+	"click": true, "print": true, "printable": true, "now": true, "file": true,
+	"the": true, "this": true, "worksheet": true, "to": true,
+}
+
+// isGenericLinkText: text chỉ gồm các từ kiểu "download", "pdf", "click here".
+func isGenericLinkText(s string) bool {
+	for _, w := range strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+		return !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9')
+	}) {
+		if !genericLinkWords[w] {
+			return false
+		}
+	}
+	return true
+}
+
+// pdfFileTitle: "color-by-number_1.pdf" -> "color by number 1".
+func pdfFileTitle(u string) string {
+	name := u
+	if pu, err := url.Parse(u); err == nil {
+		name = path.Base(pu.Path)
+		if un, err := url.PathUnescape(name); err == nil {
+			name = un
+		}
+	}
+	name = strings.TrimSuffix(name, path.Ext(name))
+	name = strings.NewReplacer("-", " ", "_", " ", "+", " ").Replace(name)
+	return cleanText(name)
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// hostLimiter: token bucket riêng cho từng host (rate req/s, burst).
+// rate <= 0 nghĩa là không giới hạn (trừ host đã bị SetMinInterval).
+type hostLimiter struct {
+	mu      sync.Mutex
+	rate    float64
+	burst   int
+	buckets map[string]*tokenBucket
+}
+
+type tokenBucket struct {
+	rate   float64
+	burst  int
+	tokens float64
+	last   time.Time
+}
+
+func newHostLimiter(rate float64, burst int) *hostLimiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &hostLimiter{rate: rate, burst: burst, buckets: map[string]*tokenBucket{}}
+}
+
+// Wait chặn tới khi host còn token hoặc ctx bị huỷ. Token được "đặt trước"
+// trong lock rồi mới sleep ngoài lock, nên nhiều worker chờ cùng host vẫn
+// xếp hàng đều.
+func (l *hostLimiter) Wait(ctx context.Context, host string) error {
+	d := l.reserve(host)
+	if d <= 0 {
+		return ctx.Err()
+	}
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// SetMinInterval: đảm bảo host không bị gọi dày hơn d (ví dụ Crawl-delay
+// trong robots.txt). Chỉ siết chặt hơn, không bao giờ nới rate hiện tại.
+func (l *hostLimiter) SetMinInterval(host string, d time.Duration) {
+	if l == nil || d <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	b := l.bucket(host, time.Now())
+	if r := 1 / d.Seconds(); b.rate <= 0 || r < b.rate {
+		b.rate, b.burst = r, 1
+		if b.tokens > 1 {
+			b.tokens = 1
+		}
+	}
+}
+
+func (l *hostLimiter) bucket(host string, now time.Time) *tokenBucket {
+	b, ok := l.buckets[host]
+	if !ok {
+		b = &tokenBucket{rate: l.rate, burst: l.burst, tokens: float64(l.burst), last: now}
+		l.buckets[host] = b
+	}
+	return b
+}
+
+func (l *hostLimiter) reserve(host string) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	b := l.bucket(host, now)
+	if b.rate <= 0 {
+		return 0
+	}
+	// nạp lại token theo thời gian đã trôi qua
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > float64(b.burst) {
+		b.tokens = float64(b.burst)
+	}
+	b.last = now
+
+	b.tokens--
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// rateLimitTransport: RoundTripper chờ limiter theo req.URL.Host trước mỗi request.
+type rateLimitTransport struct {
+	next http.RoundTripper
+	lim  *hostLimiter
+}
+
+func (t *rateLimitTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if err := t.lim.Wait(req.Context(), req.URL.Host); err != nil {
+		return nil, err
+	}
+	return t.next.RoundTrip(req)
+}
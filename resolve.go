@@ -0,0 +1,212 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Trạng thái pdf_url sau resolve pass (Item.PDFStatus).
+const (
+	pdfStatusDirect     = "direct"     // pdf_url trỏ thẳng file PDF
+	pdfStatusResolved   = "resolved"   // pdf_url gốc là trang HTML, đã thay bằng link PDF thật
+	pdfStatusUnresolved = "unresolved" // không tìm được PDF, UI đánh dấu / cho ẩn
+)
+
+const (
+	resolveMaxHops = 3       // số trang HTML tối đa đi qua để tới file PDF (cả downloadPDF và verify)
+	resolveMaxHTML = 2 << 20 // chỉ đọc tối đa 2MB mỗi trang HTML
+)
+
+// ResolvePDFURLs: pass chạy sau crawl, đổi các pdf_url thực ra là trang HTML
+// (ví dụ .../word-search/) thành link PDF trực tiếp để lúc merge khỏi phải
+// scrape lại. Link gốc giữ ở landing_url; item không resolve được thì
+// pdf_status = unresolved. Item đã có pdf_status được bỏ qua, trừ khi
+// recheck = true thì thử lại các item unresolved. Item resolve ra cùng PDF
+// với một item đứng trước được gộp vào item đó (link gốc thành alias).
+// File data được ghi lại nguyên khối (tmp + rename). ctx bị huỷ (Ctrl-C):
+// không resolve thêm item, ghi lại kết quả đã có; item chưa xử lý giữ
+// pdf_status rỗng để lần chạy sau làm tiếp.
+func ResolvePDFURLs(ctx context.Context, path, ua string, cfg CrawlConfig, recheck bool) error {
+	items, err := loadItems(path)
+	if err != nil {
+		return err
+	}
+	if ua == "" {
+		ua = downloadUserAgent
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	client, lim := newCrawlClient(cfg)
+	robots := newRobotsCache(client, ua, lim)
+
+	var todo []int
+	for i, it := range items {
+		switch {
+		case it.PDFStatus == pdfStatusUnresolved && recheck:
+		case it.PDFStatus != "":
+			continue
+		case hasPDFSuffix(it.PDFURL):
+			// link .pdf coi như trực tiếp, không tốn request
+			items[i].PDFStatus = pdfStatusDirect
+			continue
+		}
+		todo = append(todo, i)
+	}
+	log.Printf("[resolve] %s: %d items, %d to resolve", path, len(items), len(todo))
+	if len(todo) == 0 {
+		return writeItemsAtomic(path, items)
+	}
+
+	runErr := forEachParallel(ctx, len(todo), cfg.Workers, func(k int) {
+		resolveItem(ctx, client, robots, ua, &items[todo[k]])
+	})
+	if runErr != nil {
+		log.Printf("[resolve] %s: stopped (%v), saving what was resolved so far", path, runErr)
+	}
+
+	// resolve xong có thể trùng pdf_url với item khác -> giữ item đầu tiên,
+	// link gốc của bản trùng vào Aliases như dedup (mergeDuplicate)
+	var out []Item
+	seen := make(map[string]int, len(items)) // pdf_url -> index trong out
+	resolved, unresolved, dup := 0, 0, 0
+	for _, it := range items {
+		if k, ok := seen[it.PDFURL]; ok {
+			log.Printf("  [resolve] %s -> same PDF as %q, kept as alias", tern(it.LandingURL != "", it.LandingURL, it.PDFURL), out[k].Title)
+			out[k] = mergeResolvedDuplicate(out[k], it)
+			dup++
+			continue
+		}
+		seen[it.PDFURL] = len(out)
+		switch it.PDFStatus {
+		case pdfStatusResolved:
+			resolved++
+		case pdfStatusUnresolved:
+			unresolved++
+		}
+		out = append(out, it)
+	}
+	log.Printf("[resolve] %s: resolved=%d unresolved=%d duplicates merged into aliases=%d", path, resolved, unresolved, dup)
+	if err := writeItemsAtomic(path, out); err != nil {
+		return err
+	}
+	return runErr
+}
+
+// mergeResolvedDuplicate gộp dup (resolve ra cùng PDF với keep) vào keep:
+// link gốc của dup (landing_url, không có thì pdf_url) thành alias.
+func mergeResolvedDuplicate(keep, dup Item) Item {
+	if dup.LandingURL != "" {
+		dup.PDFURL = dup.LandingURL
+	}
+	keep = mergeDuplicate(keep, dup)
+	aliases := keep.Aliases[:0]
+	for _, a := range keep.Aliases {
+		if a != keep.PDFURL && a != keep.LandingURL {
+			aliases = append(aliases, a)
+		}
+	}
+	keep.Aliases = aliases
+	return keep
+}
+
+func resolveItem(ctx context.Context, client *http.Client, robots *robotsCache, ua string, it *Item) {
+	landing := it.PDFURL
+	if it.LandingURL != "" {
+		landing = it.LandingURL
+	}
+	final, err := resolvePDFURL(ctx, client, robots, ua, landing)
+	if err != nil && ctx.Err() != nil {
+		return // bị huỷ giữa chừng: giữ nguyên item cho lần sau
+	}
+	if err != nil {
+		log.Printf("  [resolve] %s -> %v", landing, err)
+		it.PDFURL, it.LandingURL = landing, ""
+		it.PDFStatus = pdfStatusUnresolved
+		return
+	}
+	if final == landing {
+		it.PDFStatus = pdfStatusDirect
+		return
+	}
+	it.PDFURL, it.LandingURL = final, landing
+	it.PDFStatus = pdfStatusResolved
+}
+
+// resolvePDFURL đi theo redirect và link PDF trong HTML (findPDFLinkInHTML)
+// tới khi gặp response là PDF, trả URL cuối cùng.
+func resolvePDFURL(ctx context.Context, client *http.Client, robots *robotsCache, ua, u string) (string, error) {
+	for hop := 0; hop <= resolveMaxHops; hop++ {
+		if !robots.Allowed(u) {
+			return "", errRobotsDisallowed
+		}
+		final, ct, body, err := probeURL(ctx, client, ua, u)
+		if err != nil {
+			return "", err
+		}
+		switch {
+		case isPDFResponse(ct, u):
+			return final, nil
+		case !strings.Contains(ct, "html"):
+			return "", fmt.Errorf("unsupported content-type %q", ct)
+		}
+		next := findPDFLinkInHTML(body, final)
+		if next == "" || next == u || next == final {
+			return "", fmt.Errorf("no PDF link on %s", final)
+		}
+		u = next
+	}
+	return "", fmt.Errorf("no PDF after %d pages", resolveMaxHops)
+}
+
+// probeURL: HEAD trước (rẻ); server không hỗ trợ HEAD hoặc trả HTML thì GET.
+// Body chỉ đọc khi là HTML.
+func probeURL(ctx context.Context, client *http.Client, ua, u string) (final, ct, body string, err error) {
+	if resp, err := doProbe(ctx, client, "HEAD", ua, u); err == nil {
+		resp.Body.Close()
+		ct = strings.ToLower(resp.Header.Get("Content-Type"))
+		if resp.StatusCode < 400 && isPDFResponse(ct, u) {
+			return resp.Request.URL.String(), ct, "", nil
+		}
+	}
+
+	resp, err := doProbe(ctx, client, "GET", ua, u)
+	if err != nil {
+		return "", "", "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return "", "", "", fmt.Errorf("http %d", resp.StatusCode)
+	}
+	final = resp.Request.URL.String()
+	ct = strings.ToLower(resp.Header.Get("Content-Type"))
+	if strings.Contains(ct, "html") {
+		b, err := io.ReadAll(io.LimitReader(resp.Body, resolveMaxHTML))
+		if err != nil {
+			return "", "", "", err
+		}
+		body = string(b)
+	}
+	return final, ct, body, nil
+}
+
+func doProbe(ctx context.Context, client *http.Client, method, ua, u string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", ua)
+	return client.Do(req)
+}
+
+func hasPDFSuffix(u string) bool {
+	if pu, err := url.Parse(u); err == nil {
+		return strings.HasSuffix(strings.ToLower(pu.Path), ".pdf")
+	}
+	return strings.HasSuffix(strings.ToLower(u), ".pdf")
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+// Huỷ ctx giữa resolve pass: item đã resolve được ghi lại, item còn lại giữ
+// pdf_status rỗng cho lần chạy sau.
+func TestResolvePDFURLsCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var once sync.Once
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			http.NotFound(w, r)
+		case "/page/1/":
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<a href="/files/1.pdf">Download</a>`))
+			once.Do(cancel) // Ctrl-C trong lúc đang resolve item đầu
+		case "/files/1.pdf":
+			w.Header().Set("Content-Type", "application/pdf")
+		default:
+			w.Header().Set("Content-Type", "text/html")
+			w.Write([]byte(`<p>nothing</p>`))
+		}
+	}))
+	defer srv.Close()
+
+	path := filepath.Join(t.TempDir(), "items.jsonl")
+	in := []Item{
+		{Title: "one", PDFURL: srv.URL + "/page/1/"},
+		{Title: "two", PDFURL: srv.URL + "/page/2/"},
+		{Title: "three", PDFURL: srv.URL + "/page/3/"},
+	}
+	if err := writeItemsAtomic(path, in); err != nil {
+		t.Fatal(err)
+	}
+	err := ResolvePDFURLs(ctx, path, "", CrawlConfig{Workers: 1}, false)
+	if err != context.Canceled {
+		t.Fatalf("err = %v, want context.Canceled", err)
+	}
+	got, err := loadItems(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 3 {
+		t.Fatalf("got %d items, want 3", len(got))
+	}
+	if got[0].PDFStatus != pdfStatusResolved && got[0].PDFStatus != "" {
+		t.Errorf("item 0 status = %q, want resolved or untouched", got[0].PDFStatus)
+	}
+	for i, it := range got[1:] {
+		if it.PDFStatus != "" || it.PDFURL != in[i+1].PDFURL || it.LandingURL != "" {
+			t.Errorf("item %d = %+v, want untouched %+v", i+1, it, in[i+1])
+		}
+	}
+}
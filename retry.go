@@ -0,0 +1,170 @@
+package main
+
+import (
+	"context"
+	"io"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// retryPolicy: chính sách retry dùng chung cho crawler và downloadPDF.
+// Chỉ retry lỗi mạng, 429 và 5xx; backoff mũ có jitter, ưu tiên Retry-After.
+type retryPolicy struct {
+	Attempts      int           // tổng số lần thử, kể cả lần đầu (>= 1)
+	BaseDelay     time.Duration // chờ trước lần retry đầu tiên, sau đó nhân đôi
+	MaxDelay      time.Duration // trần cho backoff
+	MaxRetryAfter time.Duration // trần cho Retry-After do server gửi
+}
+
+var defaultRetryPolicy = retryPolicy{
+	Attempts:      3,
+	BaseDelay:     500 * time.Millisecond,
+	MaxDelay:      10 * time.Second,
+	MaxRetryAfter: 2 * time.Minute,
+}
+
+// withRetries: policy mặc định với số lần retry (không tính lần đầu) cho trước.
+func withRetries(retries int) retryPolicy {
+	p := defaultRetryPolicy
+	p.Attempts = max(retries, 0) + 1
+	return p
+}
+
+func retryableStatus(code int) bool {
+	return code == http.StatusTooManyRequests || code >= 500
+}
+
+// backoff cho lần retry thứ n (n >= 1): BaseDelay*2^(n-1), trần MaxDelay,
+// jitter ngẫu nhiên trong [d/2, d] để các worker không dồn vào cùng lúc.
+func (p retryPolicy) backoff(n int) time.Duration {
+	d := p.BaseDelay << (n - 1)
+	if d <= 0 || d > p.MaxDelay {
+		d = p.MaxDelay
+	}
+	if d <= 1 {
+		return d
+	}
+	return d/2 + time.Duration(rand.Int64N(int64(d/2)+1))
+}
+
+// retryAfter đọc header Retry-After (số giây hoặc HTTP date).
+func retryAfter(h http.Header, now time.Time) (time.Duration, bool) {
+	v := h.Get("Retry-After")
+	if v == "" {
+		return 0, false
+	}
+	if sec, err := strconv.Atoi(v); err == nil && sec >= 0 {
+		return time.Duration(sec) * time.Second, true
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		return max(t.Sub(now), 0), true
+	}
+	return 0, false
+}
+
+// retryTransport: RoundTripper áp retryPolicy cho mọi request có thể gửi lại.
+// perAttempt > 0: mỗi lần thử (kể cả đọc body) có deadline riêng, server treo
+// chỉ giữ worker tối đa perAttempt rồi được thử lại.
+type retryTransport struct {
+	next       http.RoundTripper
+	policy     retryPolicy
+	perAttempt time.Duration
+}
+
+// cancelBody huỷ context của lần thử khi body được đóng.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b cancelBody) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+// attempt gửi req một lần, với deadline perAttempt nếu có.
+func (t *retryTransport) attempt(req *http.Request) (*http.Response, error) {
+	if t.perAttempt <= 0 {
+		return t.next.RoundTrip(req)
+	}
+	ctx, cancel := context.WithTimeout(req.Context(), t.perAttempt)
+	resp, err := t.next.RoundTrip(req.WithContext(ctx))
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	resp.Body = cancelBody{resp.Body, cancel}
+	return resp, nil
+}
+
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// request có body không tua lại được -> chỉ gửi một lần
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return t.attempt(req)
+	}
+
+	for n := 1; ; n++ {
+		if n > 1 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := t.attempt(req)
+		if err == nil && !retryableStatus(resp.StatusCode) {
+			return resp, nil
+		}
+		if n >= t.policy.Attempts || req.Context().Err() != nil {
+			return resp, err
+		}
+
+		wait := t.policy.backoff(n)
+		if err == nil {
+			if ra, ok := retryAfter(resp.Header, time.Now()); ok {
+				wait = min(ra, t.policy.MaxRetryAfter)
+			}
+		}
+		if dl, ok := req.Context().Deadline(); ok && time.Until(dl) < wait {
+			// chờ xong thì request đã hết hạn (Client.Timeout, ctx) -> trả luôn kết quả lần này
+			return resp, err
+		}
+		if err == nil {
+			// đọc bỏ body để connection được tái sử dụng
+			_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			return nil, req.Context().Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// newRetryClient: http.Client có retry bọc ngoài next (nil = DefaultTransport).
+func newRetryClient(next http.RoundTripper, policy retryPolicy, perAttempt time.Duration) *http.Client {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	return &http.Client{
+		Timeout:   policy.clientTimeout(perAttempt),
+		Transport: &retryTransport{next: next, policy: policy, perAttempt: perAttempt},
+	}
+}
+
+// clientTimeout: trần cho cả chuỗi retry (http.Client.Timeout): mọi lần thử
+// (perAttempt mỗi lần, retryTransport tự cắt) cộng backoff tối đa giữa các
+// lần. Retry-After dài hơn phần còn lại thì RoundTrip trả luôn 429/503 thay
+// vì chờ, nên MaxRetryAfter không nới trần này.
+func (p retryPolicy) clientTimeout(perAttempt time.Duration) time.Duration {
+	n := time.Duration(max(p.Attempts, 1))
+	return perAttempt*n + p.MaxDelay*(n-1)
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+// scriptStep: một response do scriptServer trả; bước cuối của mỗi path lặp lại.
+type scriptStep struct {
+	status      int
+	retryAfter  string
+	reset       bool          // đóng kết nối (RST) không trả response
+	stall       time.Duration // treo trước khi trả lời (client bỏ đi thì thôi)
+	contentType string
+	body        string
+}
+
+// scriptServer: httptest server trả lần lượt các bước theo path, đếm số lần gọi.
+type scriptServer struct {
+	*httptest.Server
+	mu    sync.Mutex
+	steps map[string][]scriptStep
+	hits  map[string]int
+}
+
+func newScriptServer(t *testing.T, steps map[string][]scriptStep) *scriptServer {
+	t.Helper()
+	s := &scriptServer{steps: steps, hits: map[string]int{}}
+	s.Server = httptest.NewServer(http.HandlerFunc(s.serve))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *scriptServer) serve(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	script, ok := s.steps[r.URL.Path]
+	s.hits[r.URL.Path]++
+	n := s.hits[r.URL.Path]
+	s.mu.Unlock()
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	st := script[min(n, len(script))-1]
+	if st.stall > 0 {
+		select {
+		case <-time.After(st.stall):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	if st.reset {
+		conn, _, err := w.(http.Hijacker).Hijack()
+		if err != nil {
+			return
+		}
+		if tc, ok := conn.(*net.TCPConn); ok {
+			_ = tc.SetLinger(0)
+		}
+		conn.Close()
+		return
+	}
+	if st.retryAfter != "" {
+		w.Header().Set("Retry-After", st.retryAfter)
+	}
+	if st.contentType != "" {
+		w.Header().Set("Content-Type", st.contentType)
+	}
+	w.WriteHeader(st.status)
+	_, _ = w.Write([]byte(st.body))
+}
+
+func (s *scriptServer) count(path string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.hits[path]
+}
+
+// testRetryPolicy: backoff vài ms để test chạy nhanh; Retry-After bị cắt ở 50ms.
+func testRetryPolicy(attempts int) retryPolicy {
+	return retryPolicy{
+		Attempts:      attempts,
+		BaseDelay:     time.Millisecond,
+		MaxDelay:      5 * time.Millisecond,
+		MaxRetryAfter: 50 * time.Millisecond,
+	}
+}
+
+func TestRetryTransport(t *testing.T) {
+	future := time.Now().Add(time.Hour).UTC().Format(http.TimeFormat)
+	tests := []struct {
+		name       string
+		steps      []scriptStep
+		attempts   int
+		wantStatus int // 0 = muốn lỗi
+		wantHits   int
+		minElapsed time.Duration
+	}{
+		{
+			name:       "429 with Retry-After seconds",
+			steps:      []scriptStep{{status: 429, retryAfter: "1"}, {status: 200}},
+			attempts:   3,
+			wantStatus: 200,
+			wantHits:   2,
+			minElapsed: 50 * time.Millisecond, // Retry-After 1s, cắt ở MaxRetryAfter
+		},
+		{
+			name:       "503 with Retry-After HTTP date",
+			steps:      []scriptStep{{status: 503, retryAfter: future}, {status: 200}},
+			attempts:   3,
+			wantStatus: 200,
+			wantHits:   2,
+			minElapsed: 50 * time.Millisecond,
+		},
+		{
+			name:       "503 without Retry-After backs off",
+			steps:      []scriptStep{{status: 503}, {status: 502}, {status: 200}},
+			attempts:   3,
+			wantStatus: 200,
+			wantHits:   3,
+		},
+		{
+			name:       "connection reset",
+			steps:      []scriptStep{{reset: true}, {status: 200}},
+			attempts:   3,
+			wantStatus: 200,
+			wantHits:   2,
+		},
+		{
+			name:       "gives up after attempts on 5xx",
+			steps:      []scriptStep{{status: 503}},
+			attempts:   3,
+			wantStatus: 503,
+			wantHits:   3,
+		},
+		{
+			name:     "gives up after attempts on resets",
+			steps:    []scriptStep{{reset: true}},
+			attempts: 2,
+			wantHits: 2,
+		},
+		{
+			name:       "no retry on 404",
+			steps:      []scriptStep{{status: 404}, {status: 200}},
+			attempts:   3,
+			wantStatus: 404,
+			wantHits:   1,
+		},
+		{
+			name:       "no retry on 403",
+			steps:      []scriptStep{{status: 403}, {status: 200}},
+			attempts:   3,
+			wantStatus: 403,
+			wantHits:   1,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newScriptServer(t, map[string][]scriptStep{"/": tc.steps})
+			base := &http.Transport{}
+			defer base.CloseIdleConnections()
+			client := newRetryClient(base, testRetryPolicy(tc.attempts), 5*time.Second)
+
+			start := time.Now()
+			resp, err := client.Get(srv.URL + "/")
+			elapsed := time.Since(start)
+			if tc.wantStatus == 0 {
+				if err == nil {
+					resp.Body.Close()
+					t.Fatalf("want error, got status %d", resp.StatusCode)
+				}
+			} else {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				resp.Body.Close()
+				if resp.StatusCode != tc.wantStatus {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tc.wantStatus)
+				}
+			}
+			if got := srv.count("/"); got != tc.wantHits {
+				t.Errorf("hits = %d, want %d", got, tc.wantHits)
+			}
+			if elapsed < tc.minElapsed {
+				t.Errorf("elapsed %v, want >= %v (Retry-After not honoured)", elapsed, tc.minElapsed)
+			}
+		})
+	}
+}
+
+// Retry-After dài hơn thời gian còn lại của request: trả ngay response hiện
+// tại thay vì ngủ rồi bị Client.Timeout cắt.
+func TestRetryTransportRetryAfterPastDeadline(t *testing.T) {
+	srv := newScriptServer(t, map[string][]scriptStep{"/": {{status: 503, retryAfter: "30"}, {status: 200}}})
+	p := testRetryPolicy(3)
+	p.MaxRetryAfter = time.Minute
+	client := &http.Client{Timeout: 300 * time.Millisecond, Transport: &retryTransport{next: &http.Transport{}, policy: p}}
+
+	start := time.Now()
+	resp, err := client.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != 503 {
+		t.Errorf("status = %d, want 503", resp.StatusCode)
+	}
+	if d := time.Since(start); d > 250*time.Millisecond {
+		t.Errorf("took %v, want the 503 returned without waiting", d)
+	}
+	if got := srv.count("/"); got != 1 {
+		t.Errorf("hits = %d, want 1", got)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{now.Add(90 * time.Second).Format(http.TimeFormat), 90 * time.Second, true},
+		{now.Add(-time.Minute).Format(http.TimeFormat), 0, true},
+		{"-5", 0, false},
+		{"soon", 0, false},
+	}
+	for _, tc := range tests {
+		h := http.Header{}
+		if tc.value != "" {
+			h.Set("Retry-After", tc.value)
+		}
+		got, ok := retryAfter(h, now)
+		if got != tc.want || ok != tc.wantOK {
+			t.Errorf("retryAfter(%q) = %v, %v; want %v, %v", tc.value, got, ok, tc.want, tc.wantOK)
+		}
+	}
+}
+
+// Server treo ở lần đầu: lần thử bị cắt sau perAttempt rồi retry, không
+// đợi hết Client.Timeout.
+func TestRetryTransportPerAttemptTimeout(t *testing.T) {
+	srv := newScriptServer(t, map[string][]scriptStep{"/": {{stall: 5 * time.Second}, {status: 200, body: "ok"}}})
+	client := newRetryClient(&http.Transport{}, testRetryPolicy(3), 100*time.Millisecond)
+
+	start := time.Now()
+	resp, err := client.Get(srv.URL + "/")
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil || string(body) != "ok" {
+		t.Errorf("body = %q, %v; want ok", body, err)
+	}
+	if d := time.Since(start); d > 2*time.Second {
+		t.Errorf("took %v, want the stalled attempt cut after 100ms", d)
+	}
+	if got := srv.count("/"); got != 2 {
+		t.Errorf("hits = %d, want 2", got)
+	}
+}
+
+// Trần của cả chuỗi retry chỉ gồm các lần thử và backoff; Retry-After dài
+// không được kéo Client.Timeout lên hàng phút.
+func TestClientTimeoutBounded(t *testing.T) {
+	p := withRetries(2)
+	perAttempt := 30 * time.Second
+	want := 3*perAttempt + 2*p.MaxDelay
+	if got := p.clientTimeout(perAttempt); got != want {
+		t.Errorf("clientTimeout = %v, want %v (3 attempts + 2 max backoffs)", got, want)
+	}
+}
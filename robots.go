@@ -0,0 +1,223 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errRobotsDisallowed = errors.New("disallowed by robots.txt")
+
+// robotsRules: các rule Allow/Disallow của group khớp User-Agent của ta.
+type robotsRules struct {
+	rules      []robotsRule
+	crawlDelay time.Duration
+}
+
+type robotsRule struct {
+	allow   bool
+	pattern string
+}
+
+// parseRobots đọc robots.txt và giữ lại group dành cho ua: group có
+// user-agent khớp product token dài nhất thắng, không có thì dùng "*".
+func parseRobots(r io.Reader, ua string) *robotsRules {
+	product := strings.ToLower(ua)
+	if i := strings.IndexAny(product, "/ "); i >= 0 {
+		product = product[:i]
+	}
+
+	type group struct {
+		agents []string
+		rr     robotsRules
+	}
+	var groups []*group
+	var cur *group
+	lastWasAgent := false
+
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := sc.Text()
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		key, val, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		val = strings.TrimSpace(val)
+
+		switch key {
+		case "user-agent":
+			// các dòng user-agent liên tiếp thuộc cùng một group
+			if cur == nil || !lastWasAgent {
+				cur = &group{}
+				groups = append(groups, cur)
+			}
+			cur.agents = append(cur.agents, strings.ToLower(val))
+			lastWasAgent = true
+			continue
+		case "allow", "disallow":
+			if cur != nil && val != "" {
+				cur.rr.rules = append(cur.rr.rules, robotsRule{allow: key == "allow", pattern: val})
+			}
+		case "crawl-delay":
+			if cur != nil {
+				if sec, err := strconv.ParseFloat(val, 64); err == nil && sec > 0 {
+					cur.rr.crawlDelay = time.Duration(sec * float64(time.Second))
+				}
+			}
+		}
+		lastWasAgent = false
+	}
+
+	var best *robotsRules
+	bestLen := -1
+	for _, g := range groups {
+		for _, a := range g.agents {
+			n := -1
+			switch {
+			case a == "*":
+				n = 0
+			case a != "" && strings.Contains(product, a):
+				n = len(a)
+			}
+			if n > bestLen {
+				best, bestLen = &g.rr, n
+			} else if n >= 0 && n == bestLen {
+				// group trùng agent -> gộp rule
+				best.rules = append(best.rules, g.rr.rules...)
+				if g.rr.crawlDelay > best.crawlDelay {
+					best.crawlDelay = g.rr.crawlDelay
+				}
+			}
+		}
+	}
+	if best == nil {
+		return &robotsRules{}
+	}
+	return best
+}
+
+// Allowed: rule khớp dài nhất thắng; bằng nhau thì Allow thắng.
+func (rr *robotsRules) Allowed(path string) bool {
+	allow, matchLen := true, -1
+	for _, r := range rr.rules {
+		if !robotsMatch(r.pattern, path) {
+			continue
+		}
+		if n := len(r.pattern); n > matchLen || (n == matchLen && r.allow) {
+			allow, matchLen = r.allow, n
+		}
+	}
+	return allow
+}
+
+// robotsMatch: prefix match có hỗ trợ '*' (mọi chuỗi) và '$' (hết URL).
+func robotsMatch(pattern, path string) bool {
+	anchored := strings.HasSuffix(pattern, "$")
+	pattern = strings.TrimSuffix(pattern, "$")
+	parts := strings.Split(pattern, "*")
+
+	if !strings.HasPrefix(path, parts[0]) {
+		return false
+	}
+	pos := len(parts[0])
+	for i, p := range parts[1:] {
+		last := i == len(parts)-2
+		if last && anchored {
+			return strings.HasSuffix(path[pos:], p)
+		}
+		j := strings.Index(path[pos:], p)
+		if j < 0 {
+			return false
+		}
+		pos += j + len(p)
+	}
+	return !anchored || pos == len(path)
+}
+
+// robotsCache: tải robots.txt mỗi host đúng một lần trong một lần crawl.
+// Crawl-delay lớn hơn khoảng cách hiện tại của limiter sẽ được áp cho host đó.
+type robotsCache struct {
+	client Fetcher
+	ua     string
+	lim    *hostLimiter
+
+	mu    sync.Mutex
+	hosts map[string]*robotsEntry
+}
+
+type robotsEntry struct {
+	once  sync.Once
+	rules *robotsRules
+}
+
+func newRobotsCache(client Fetcher, ua string, lim *hostLimiter) *robotsCache {
+	return &robotsCache{client: client, ua: ua, lim: lim, hosts: map[string]*robotsEntry{}}
+}
+
+func (c *robotsCache) Allowed(rawURL string) bool {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return true
+	}
+	key := u.Scheme + "://" + u.Host
+
+	c.mu.Lock()
+	e, ok := c.hosts[key]
+	if !ok {
+		e = &robotsEntry{}
+		c.hosts[key] = e
+	}
+	c.mu.Unlock()
+
+	e.once.Do(func() {
+		e.rules = c.fetch(key)
+		if e.rules.crawlDelay > 0 {
+			c.lim.SetMinInterval(u.Host, e.rules.crawlDelay)
+		}
+	})
+
+	path := u.EscapedPath()
+	if path == "" {
+		path = "/"
+	}
+	if u.RawQuery != "" {
+		path += "?" + u.RawQuery
+	}
+	return e.rules.Allowed(path)
+}
+
+// fetch: 4xx = không có robots.txt (cho phép hết); 5xx/lỗi mạng = chặn hết
+// theo RFC 9309 cho tới lần chạy sau.
+func (c *robotsCache) fetch(origin string) *robotsRules {
+	disallowAll := &robotsRules{rules: []robotsRule{{allow: false, pattern: "/"}}}
+
+	req, _ := http.NewRequest("GET", origin+"/robots.txt", nil)
+	req.Header.Set("User-Agent", c.ua)
+	resp, err := c.client.Do(req)
+	if err != nil {
+		log.Printf("[robots] %s: %v (treat as disallow all)", origin, err)
+		return disallowAll
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode >= 500:
+		log.Printf("[robots] %s: http %d (treat as disallow all)", origin, resp.StatusCode)
+		return disallowAll
+	case resp.StatusCode >= 400:
+		return &robotsRules{}
+	}
+	rr := parseRobots(io.LimitReader(resp.Body, 512<<10), c.ua)
+	log.Printf("[robots] %s: %d rules, crawl-delay=%v", origin, len(rr.rules), rr.crawlDelay)
+	return rr
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+const testRobots = `
+# comment
+User-agent: *
+Disallow: /private/
+Crawl-delay: 1
+
+User-agent: WorksheetMerger
+User-agent: otherbot
+Disallow: /downloads/
+Allow: /downloads/free/
+Disallow: /*.zip$
+Disallow: /search*q=
+Crawl-delay: 2.5
+
+User-agent: worksheetmerger
+Disallow: /tmp/
+`
+
+func TestParseRobotsGroups(t *testing.T) {
+	tests := []struct {
+		name      string
+		ua        string
+		wantRules int
+		wantDelay time.Duration
+		blocked   string // path group này chặn
+		allowed   string // path group này cho
+	}{
+		{"specific group wins and same-agent groups merge", "WorksheetMerger/1.1 (+https://example.local)", 5, 2500 * time.Millisecond, "/tmp/x", "/private/x"},
+		{"second agent line of a group", "OtherBot/2.0", 4, 2500 * time.Millisecond, "/downloads/a.pdf", "/tmp/x"},
+		{"unknown agent falls back to *", "Mozilla/5.0", 1, time.Second, "/private/x", "/downloads/a.pdf"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			rr := parseRobots(strings.NewReader(testRobots), tc.ua)
+			if len(rr.rules) != tc.wantRules {
+				t.Errorf("rules = %+v, want %d", rr.rules, tc.wantRules)
+			}
+			if rr.crawlDelay != tc.wantDelay {
+				t.Errorf("crawl-delay = %v, want %v", rr.crawlDelay, tc.wantDelay)
+			}
+			if rr.Allowed(tc.blocked) {
+				t.Errorf("Allowed(%q) = true, want false", tc.blocked)
+			}
+			if !rr.Allowed(tc.allowed) {
+				t.Errorf("Allowed(%q) = false, want true", tc.allowed)
+			}
+		})
+	}
+
+	if rr := parseRobots(strings.NewReader("User-agent: googlebot\nDisallow: /\n"), "WorksheetMerger/1.1"); len(rr.rules) != 0 || !rr.Allowed("/x") {
+		t.Errorf("no matching group and no * group: rules = %+v, want allow all", rr.rules)
+	}
+}
+
+func TestRobotsAllowed(t *testing.T) {
+	rr := parseRobots(strings.NewReader(testRobots), "otherbot")
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/", true},
+		{"/downloads/", false},
+		{"/downloads/a.pdf", false},
+		{"/downloads/free/a.pdf", true}, // Allow dài hơn thắng
+		{"/files/set.zip", false},
+		{"/files/set.zip?v=1", true}, // $ neo cuối URL
+		{"/search?q=cats", false},
+		{"/search/cats?page=2&q=dogs", false},
+		{"/search?page=2", true},
+	}
+	for _, tc := range tests {
+		if got := rr.Allowed(tc.path); got != tc.want {
+			t.Errorf("Allowed(%q) = %v, want %v", tc.path, got, tc.want)
+		}
+	}
+
+	// cùng độ dài: Allow thắng
+	tie := &robotsRules{rules: []robotsRule{{allow: false, pattern: "/page"}, {allow: true, pattern: "/page"}}}
+	if !tie.Allowed("/page/1") {
+		t.Error("equal-length Allow/Disallow: want Allow to win")
+	}
+}
+
+func TestRobotsMatch(t *testing.T) {
+	tests := []struct {
+		pattern, path string
+		want          bool
+	}{
+		{"/", "/anything", true},
+		{"/a", "/abc", true},
+		{"/a", "/b", false},
+		{"/a/*/c", "/a/b/c", true},
+		{"/a/*/c", "/a/c", false},
+		{"/*.pdf$", "/x/y.pdf", true},
+		{"/*.pdf$", "/x/y.pdf?dl=1", false},
+		{"/*.pdf", "/x/y.pdf?dl=1", true},
+		{"/exact$", "/exact", true},
+		{"/exact$", "/exact/more", false},
+		{"*", "/whatever", true},
+		{"/b*", "/a/b", false}, // phần trước * vẫn phải là prefix
+		{"/**/x", "/a/b/x", true},
+	}
+	for _, tc := range tests {
+		if got := robotsMatch(tc.pattern, tc.path); got != tc.want {
+			t.Errorf("robotsMatch(%q, %q) = %v, want %v", tc.pattern, tc.path, got, tc.want)
+		}
+	}
+}
+
+// 4xx: coi như không có robots.txt; 5xx và lỗi mạng: chặn hết (RFC 9309).
+// Crawl-delay được áp vào limiter của host.
+func TestRobotsCacheFetch(t *testing.T) {
+	tests := []struct {
+		name      string
+		step      scriptStep
+		want      bool // Allowed("/downloads/a.pdf")
+		wantDelay time.Duration
+	}{
+		{"200 applies rules", scriptStep{status: 200, body: testRobots}, false, 2500 * time.Millisecond},
+		{"404 allows all", scriptStep{status: 404}, true, 0},
+		{"403 allows all", scriptStep{status: 403}, true, 0},
+		{"503 disallows all", scriptStep{status: 503}, false, 0},
+		{"connection reset disallows all", scriptStep{reset: true}, false, 0},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			srv := newScriptServer(t, map[string][]scriptStep{"/robots.txt": {tc.step}})
+			lim := newHostLimiter(0, 0)
+			c := newRobotsCache(http.DefaultClient, "OtherBot/2.0", lim)
+			if got := c.Allowed(srv.URL + "/downloads/a.pdf"); got != tc.want {
+				t.Errorf("Allowed = %v, want %v", got, tc.want)
+			}
+			c.Allowed(srv.URL + "/other")
+			if got := srv.count("/robots.txt"); got != 1 {
+				t.Errorf("robots.txt fetched %d times, want 1", got)
+			}
+			var got time.Duration
+			if b, ok := lim.buckets[strings.TrimPrefix(srv.URL, "http://")]; ok && b.rate > 0 {
+				got = time.Duration(float64(time.Second) / b.rate)
+			}
+			if got != tc.wantDelay {
+				t.Errorf("limiter interval = %v, want %v (Crawl-delay)", got, tc.wantDelay)
+			}
+		})
+	}
+}
@@ -1,14 +1,14 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
+	"context"
 	"fmt"
 	"log"
+	"maps"
 	"net/http"
 	"os"
 	"path/filepath"
-	"sort"
+	"slices"
 	"strings"
 	"time"
 
@@ -16,242 +16,525 @@ import (
 )
 
 type CrawlConfig struct {
-	DataPath  string
-	CPPath    string
-	StartPage int
-	EndPage   int // 0 = auto detect
-	DelayMs   int
-	MaxItems  int // 0 = unlimited
-	UserAgent string
+	DataPath       string
+	CPPath         string
+	StartPage      int
+	EndPage        int // 0 = auto detect; source lazy thì bỏ qua, cào đến khi dừng
+	DelayMs        int
+	MaxItems       int // 0 = unlimited
+	UserAgent      string
+	LazyExhaust    bool // true: tăng /page/N/ tới khi lỗi/không còn bài
+	EmptyPageLimit int  // số trang trống liên tiếp để dừng (mặc định 3 nếu =0)
+	Retry          int  // số lần retry mỗi request khi lỗi mạng/429/5xx (0 = không retry)
+
+	Workers    int     // số worker parse trang chi tiết song song (mặc định 1)
+	RatePerSec float64 // giới hạn request/giây mỗi host (0 = suy từ DelayMs)
+	Burst      int     // số request được phép dồn cùng lúc mỗi host (mặc định 1)
+
+	CacheDir     string        // thư mục cache HTTP ("" = tắt)
+	CacheMaxAge  time.Duration // trong khoảng này dùng cache không hỏi lại server (0 = luôn revalidate)
+	CacheRefresh bool          // bỏ qua cache, tải lại toàn bộ
+
+	// Incremental: cào lại từ trang 1 để lấy bài mới, dừng sau IncrementalStop
+	// trang list liên tiếp mà mọi detail URL đều đã biết. Không đụng checkpoint.
+	Incremental     bool
+	IncrementalStop int // mặc định 3 nếu =0
+
+	MaxAttempts int // số lần thử tối đa cho trang/detail lỗi trong checkpoint (mặc định 5)
+
+	Discovery  string // "list" (mặc định): duyệt trang list; "sitemap": đọc sitemap.xml
+	SitemapURL string // ghi đè URL sitemap của source (Discovery = "sitemap")
+
+	Fetcher   Fetcher // nil = HTTP thật qua newCrawlClient; truyền replayFetcher để chạy offline
+	RecordDir string  // != "" -> lưu mọi response vào thư mục fixture (xem fetcher.go)
+
+	Progress func(crawlProgress) // gọi sau mỗi trang đã ghi (UI hiển thị tiến độ), có thể nil
 }
 
-type checkpoint struct {
-	LastPage int `json:"last_page"` // đã crawl xong tới trang này
+// crawlRun: trạng thái của một lần RunCrawl.
+type crawlRun struct {
+	ctx    context.Context
+	src    Source
+	cfg    CrawlConfig
+	tag    string
+	ua     string
+	client Fetcher
+	robots *robotsCache
+	cp     checkpoint
+	store  ItemStore
+
+	seen        map[string]struct{} // pdf_url đã có -> dedup
+	knownDetail map[string]struct{} // detail URL đã biết -> incremental
+	refetch     map[string]struct{} // detail URL tải lại vì đổi (sitemap lastmod) -> item cũ được Upsert
+	batch       []Item
+	updates     []Item // bản mới của item đã có, ghi bằng Upsert
+
+	collected  int
+	updated    int
+	disallowed int
+	failed     int
+	lastPage   int // trang list gần nhất đã xong (cho Progress)
 }
 
-func RunCrawlerWithCheckpoint(cfg CrawlConfig) error {
+// RunCrawl: engine chung list -> detail -> dedup -> append -> checkpoint
+// cho mọi Source. Trước khi cào tiếp, các trang list / detail URL lỗi của
+// lần trước (ghi trong checkpoint) được thử lại.
+// ctx bị huỷ (Ctrl-C, -crawl_timeout) thì dừng sau khi ghi batch đang có và
+// checkpoint; trang đang dở không được đánh dấu xong nên lần sau cào lại.
+// Khi đó trả về ctx.Err().
+func RunCrawl(ctx context.Context, src Source, cfg CrawlConfig) error {
+	if cfg.EmptyPageLimit <= 0 {
+		cfg.EmptyPageLimit = 3
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	if cfg.IncrementalStop <= 0 {
+		cfg.IncrementalStop = 3
+	}
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 5
+	}
+
 	// chuẩn bị client
-	client := &http.Client{Timeout: 30 * time.Second}
+	client, lim := newCrawlClient(cfg)
+	var f Fetcher = client
+	if cfg.Fetcher != nil {
+		f = cfg.Fetcher
+	}
+	if cfg.RecordDir != "" {
+		f = &recordFetcher{next: f, dir: cfg.RecordDir}
+	}
+	f = ctxFetcher{ctx: ctx, next: f}
+	r := &crawlRun{ctx: ctx, src: src, cfg: cfg, tag: src.Name(), ua: src.UserAgent(), client: f}
+	if cfg.UserAgent != "" {
+		r.ua = cfg.UserAgent
+	}
+	r.robots = newRobotsCache(f, r.ua, lim)
 
-	// lấy last_page từ checkpoint (nếu có)
-	cp, _ := readCheckpoint(cfg.CPPath)
+	// checkpoint: file cũ {"last_page":N} vẫn đọc được
+	r.cp, _ = readCheckpoint(cfg.CPPath)
 	start := cfg.StartPage
-	if cp.LastPage > 0 {
-		start = cp.LastPage + 1
+	if r.cp.LastPage > 0 {
+		start = r.cp.LastPage + 1
 	}
-	if start < 1 {
+	if start < 1 || cfg.Incremental {
 		start = 1
 	}
 
-	// tìm end nếu = 0
-	end := cfg.EndPage
-	if end == 0 {
-		n, err := findMaxPages(client)
-		if err != nil {
-			log.Printf("[crawl] cannot detect max pages: %v, fallback 100", err)
-			end = 100
-		} else {
-			end = n
-		}
-	}
-
 	// ensure data dir
 	if err := osMkdirAll(filepath.Dir(absPath(cfg.DataPath)), 0o755); err != nil && !os.IsExist(err) {
 		return err
 	}
 
-	log.Printf("[crawl] start=%d end=%d data=%s cp=%s", start, end, cfg.DataPath, cfg.CPPath)
-
-	// pre-load để dedup
-	existing, _ := loadItems(cfg.DataPath)
-	seen := make(map[string]struct{}, len(existing))
-	for _, it := range existing {
+	store, err := openItemStore(cfg.DataPath)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+	r.store = store
+
+	// pre-load để dedup (theo pdf_url) và nhận biết detail URL đã biết (incremental)
+	r.seen = map[string]struct{}{}
+	r.knownDetail = map[string]struct{}{}
+	r.refetch = map[string]struct{}{}
+	if err := store.Iterate(func(it Item) error {
 		if it.PDFURL != "" {
-			seen[strings.TrimSpace(it.PDFURL)] = struct{}{}
+			r.seen[strings.TrimSpace(it.PDFURL)] = struct{}{}
+		}
+		if it.LandingURL != "" {
+			// pdf_url đã được resolve: link gốc vẫn tính là đã có
+			r.seen[strings.TrimSpace(it.LandingURL)] = struct{}{}
+		}
+		for _, a := range it.Aliases {
+			// bản trùng nội dung đã gộp vào item này
+			r.seen[strings.TrimSpace(a)] = struct{}{}
 		}
+		if it.URL != "" {
+			r.knownDetail[strings.TrimSpace(it.URL)] = struct{}{}
+		}
+		return nil
+	}); err != nil {
+		log.Printf("[%s] warn read %s: %v", r.tag, cfg.DataPath, err)
 	}
 
-	var batch []Item
-	collected := 0
+	// incremental không đụng checkpoint nên cũng không chạy retry pass
+	if !cfg.Incremental {
+		if err := r.retryFailures(); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case r.stopped():
+	case cfg.Discovery == "sitemap":
+		err = r.crawlSitemap()
+	default:
+		err = r.crawlPages(start)
+	}
+	if err == nil && r.stopped() {
+		err = ctx.Err()
+		log.Printf("[%s] stopped: %v (batch flushed, checkpoint saved)", r.tag, err)
+	}
+	r.report(0)
+	log.Printf("[%s] collected %d new items, %d updated, %d URLs disallowed by robots.txt, %d failed (pending retry: %d pages, %d details)",
+		r.tag, r.collected, r.updated, r.disallowed, r.failed, len(r.cp.FailedPages), len(r.cp.FailedDetails))
+	return err
+}
+
+// crawlPages: discovery kiểu cũ, duyệt trang list từ start.
+func (r *crawlRun) crawlPages(start int) error {
+	src, cfg := r.src, r.cfg
 
-	for p := start; p <= end; p++ {
-		listURL := resolveListURL(p)
-		log.Printf("[crawl] page %d: %s", p, listURL)
+	// Quyết định chiến lược phân trang
+	useLazy := cfg.LazyExhaust
+	if lp, ok := src.(lazyPager); ok && cfg.EndPage == 0 && lp.Lazy() {
+		useLazy = true
+	}
 
-		// tải trang list
-		doc, err := fetchDoc(client, listURL)
+	// tìm end nếu = 0
+	end := cfg.EndPage
+	if !useLazy && end == 0 {
+		n, err := src.FindMaxPages(r.client)
 		if err != nil {
-			log.Printf("[crawl] skip page %d: %v", p, err)
-			// vẫn cập nhật checkpoint để không kẹt ở trang lỗi mãi
-			_ = writeCheckpoint(cfg.CPPath, p)
-			continue
+			log.Printf("[%s] cannot detect max pages: %v, fallback 100", r.tag, err)
+			end = 100
+		} else {
+			end = n
 		}
+	}
 
-		// lấy link chi tiết
-		detailLinks := extractDetailLinks(doc, baseURL)
-		if len(detailLinks) == 0 {
-			log.Printf("[crawl] page %d: no detail links", p)
-			_ = writeCheckpoint(cfg.CPPath, p)
-			continue
-		}
+	log.Printf("[%s] crawl start=%d strategy=%s end=%d incremental=%v data=%s cp=%s",
+		r.tag, start, tern(useLazy, "lazy-exhaust", "bounded"), end, cfg.Incremental, cfg.DataPath, cfg.CPPath)
 
-		// fallback thumbnail map từ trang list (nếu cần)
-		thumbByDetail := make(map[string]string)
-		doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
-			href, _ := a.Attr("href")
-			href = toAbs(href)
-			if !isDetailURL(href) {
-				return
-			}
-			if img := a.Find("img"); img.Length() > 0 {
-				if src, ok := img.Attr("src"); ok && src != "" {
-					thumbByDetail[href] = toAbs(src)
-				}
-			}
-		})
+	emptyRun := 0
+	knownRun := 0
 
-		// duyệt chi tiết
-		for _, durl := range detailLinks {
-			if cfg.MaxItems > 0 && collected >= cfg.MaxItems {
+	for p := start; useLazy || p <= end; p++ {
+		if r.full() || r.stopped() {
+			break
+		}
+		doc, err := r.fetchList(p)
+		if err != nil {
+			if r.stopped() {
+				break
+			}
+			if useLazy {
+				// lazy: lỗi thường là đã hết trang -> lần sau chạy lại từ trang này
+				log.Printf("[%s] stop on error page %d: %v", r.tag, p, err)
 				break
 			}
-			time.Sleep(time.Duration(cfg.DelayMs) * time.Millisecond)
+			// bounded: ghi nhận trang lỗi để retry lần sau, vẫn đi tiếp
+			log.Printf("[%s] skip page %d: %v", r.tag, p, err)
+			r.cp.failPage(p, err)
+			r.cp.LastPage = p
+			r.saveCheckpoint()
+			continue
+		}
 
-			it, err := parseDetail(client, durl)
-			if err != nil {
-				log.Printf("  [detail] %s -> %v", durl, err)
+		// lấy link chi tiết + thumbnail fallback từ trang list
+		detailLinks, thumbByDetail := src.ExtractDetailLinks(doc)
+		if len(detailLinks) == 0 {
+			r.cp.donePage(p)
+			r.saveCheckpoint()
+			if !useLazy {
+				log.Printf("[%s] page %d: no detail links", r.tag, p)
 				continue
 			}
-			if it.IMGURL == "" {
-				if tb, ok := thumbByDetail[durl]; ok {
-					it.IMGURL = tb
-				}
+			emptyRun++
+			log.Printf("[%s] page %d: no detail links (emptyRun=%d)", r.tag, p, emptyRun)
+			if emptyRun >= cfg.EmptyPageLimit {
+				log.Printf("[%s] stop on empty pages (limit=%d)", r.tag, cfg.EmptyPageLimit)
+				break
 			}
-			// đủ dữ liệu và chưa trùng pdf_url?
-			if it.Title == "" || it.PDFURL == "" {
-				continue
+			// nghỉ một chút rồi tiếp
+			r.sleep(time.Duration(cfg.DelayMs) * time.Millisecond)
+			continue
+		}
+		emptyRun = 0 // reset vì có bài
+
+		// bỏ các trang chi tiết robots.txt không cho phép
+		detailLinks = r.allowedLinks(detailLinks)
+
+		// incremental: chỉ parse detail URL chưa biết; link lặp lại trên mọi trang
+		// (menu, sidebar) cũng tính là đã biết sau lần gặp đầu tiên
+		if cfg.Incremental {
+			var fresh []string
+			for _, durl := range detailLinks {
+				if _, ok := r.knownDetail[durl]; !ok {
+					fresh = append(fresh, durl)
+					r.knownDetail[durl] = struct{}{}
+				}
 			}
-			key := strings.TrimSpace(it.PDFURL)
-			if _, ok := seen[key]; ok {
+			if len(fresh) == 0 {
+				knownRun++
+				log.Printf("[%s] page %d: all %d detail URLs known (run=%d)", r.tag, p, len(detailLinks), knownRun)
+				if knownRun >= cfg.IncrementalStop {
+					log.Printf("[%s] stop incremental after %d known pages", r.tag, knownRun)
+					break
+				}
 				continue
 			}
-			seen[key] = struct{}{}
-			batch = append(batch, it)
-			collected++
+			knownRun = 0
+			detailLinks = fresh
 		}
 
-		// ghi batch ra file định kỳ (tránh mất dữ liệu nếu crash)
-		if len(batch) > 0 {
-			if err := appendItems(cfg.DataPath, batch); err != nil {
-				return err
-			}
-			batch = batch[:0]
-		}
+		r.processDetails(p, detailLinks, thumbByDetail)
 
-		// cập nhật checkpoint sau mỗi trang
-		if err := writeCheckpoint(cfg.CPPath, p); err != nil {
-			log.Printf("[crawl] warn write checkpoint: %v", err)
+		// ghi batch ra file định kỳ (tránh mất dữ liệu nếu crash)
+		if err := r.flush(); err != nil {
+			return err
 		}
-
-		if cfg.MaxItems > 0 && collected >= cfg.MaxItems {
+		if r.stopped() {
+			// trang dở: giữ các lỗi đã ghi, không đánh dấu xong
+			r.saveCheckpoint()
 			break
 		}
-	}
 
-	log.Printf("[crawl] collected %d new items", collected)
+		// cập nhật checkpoint sau mỗi trang
+		r.cp.donePage(p)
+		r.cp.LastPage = p
+		r.saveCheckpoint()
+		r.report(p)
+	}
 	return nil
 }
 
-// ---- checkpoint I/O ----
+func (r *crawlRun) full() bool {
+	return r.cfg.MaxItems > 0 && r.collected >= r.cfg.MaxItems
+}
 
-func readCheckpoint(path string) (checkpoint, error) {
-	var cp checkpoint
-	f, err := os.Open(path)
-	if err != nil {
-		return cp, err
+// report gửi tiến độ hiện tại cho cfg.Progress (nếu có); page = 0 giữ
+// trang đã báo gần nhất.
+func (r *crawlRun) report(page int) {
+	if page > 0 {
+		r.lastPage = page
 	}
-	defer f.Close()
-	if err := json.NewDecoder(f).Decode(&cp); err != nil {
-		return cp, err
+	if r.cfg.Progress != nil {
+		r.cfg.Progress(crawlProgress{Source: r.tag, Page: r.lastPage, Collected: r.collected, Failed: r.failed, Disallowed: r.disallowed})
 	}
-	return cp, nil
 }
 
-func writeCheckpoint(path string, page int) error {
-	tmp := path + ".tmp"
-	f, err := os.Create(tmp)
-	if err != nil {
-		return err
+// stopped: ctx của lần crawl đã bị huỷ hoặc hết hạn.
+func (r *crawlRun) stopped() bool {
+	return r.ctx.Err() != nil
+}
+
+// sleep như time.Sleep nhưng tỉnh dậy ngay khi ctx bị huỷ.
+func (r *crawlRun) sleep(d time.Duration) {
+	t := time.NewTimer(d)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-r.ctx.Done():
 	}
-	cp := checkpoint{LastPage: page}
-	if err := json.NewEncoder(f).Encode(&cp); err != nil {
-		f.Close()
-		_ = os.Remove(tmp)
-		return err
+}
+
+// fetchList tải trang list p (nếu robots.txt cho phép).
+func (r *crawlRun) fetchList(p int) (*goquery.Document, error) {
+	listURL := r.src.ListURL(p)
+	log.Printf("[%s] page %d: %s", r.tag, p, listURL)
+	if !r.robots.Allowed(listURL) {
+		r.disallowed++
+		return nil, errRobotsDisallowed
 	}
-	if err := f.Close(); err != nil {
-		return err
+	return fetchDocUA(r.client, listURL, r.ua)
+}
+
+// allowedLinks bỏ các URL robots.txt không cho phép (có log + đếm).
+func (r *crawlRun) allowedLinks(links []string) []string {
+	allowed := links[:0:0]
+	for _, durl := range links {
+		if !r.robots.Allowed(durl) {
+			log.Printf("  [%s/robots] disallowed %s", r.tag, durl)
+			r.disallowed++
+			continue
+		}
+		allowed = append(allowed, durl)
 	}
-	return os.Rename(tmp, path)
+	return allowed
 }
 
-// ---- append & dedup ----
+// processDetails: parse song song theo từng đợt (không vượt quá MaxItems),
+// dedup từng item (mỗi PDF một item) theo pdf_url rồi đưa vào batch. Detail lỗi được ghi vào checkpoint.
+func (r *crawlRun) processDetails(page int, links []string, thumbByDetail map[string]string) {
+	pending := links
+	for len(pending) > 0 && !r.full() && !r.stopped() {
+		n := len(pending)
+		if r.cfg.MaxItems > 0 && r.cfg.MaxItems-r.collected < n {
+			n = r.cfg.MaxItems - r.collected
+		}
+		chunk := pending[:n]
+		pending = pending[n:]
+
+		for _, res := range fetchDetails(r.ctx, r.src, r.client, chunk, r.cfg.Workers) {
+			if res.err != nil {
+				if r.stopped() {
+					// bị huỷ giữa chừng, không tính là lỗi của URL
+					continue
+				}
+				log.Printf("  [%s/detail] %s -> %v", r.tag, res.url, res.err)
+				r.cp.failDetail(res.url, page, res.err)
+				r.failed++
+				continue
+			}
+			r.cp.doneDetail(res.url)
+			for _, it := range res.items {
+				if r.full() {
+					break
+				}
+				if it.IMGURL == "" {
+					if tb, ok := thumbByDetail[res.url]; ok {
+						it.IMGURL = tb
+					}
+				}
+				if it.Source == "" {
+					it.Source = r.tag
+				}
+				it = normalizeItemSubjects(it)
+				// đủ dữ liệu và chưa trùng pdf_url?
+				if it.Title == "" || it.PDFURL == "" {
+					continue
+				}
+				key := strings.TrimSpace(it.PDFURL)
+				if _, ok := r.seen[key]; ok {
+					if _, again := r.refetch[res.url]; again {
+						r.updates = append(r.updates, it)
+						r.updated++
+					}
+					continue
+				}
+				r.seen[key] = struct{}{}
+				r.batch = append(r.batch, it)
+				r.collected++
+			}
+		}
+	}
+}
 
-func appendItems(path string, items []Item) error {
-	if len(items) == 0 {
+// retryFailures: thử lại trang list lỗi rồi detail URL lỗi của các lần trước.
+// Mục nào đã thử đủ MaxAttempts thì giữ nguyên trong checkpoint và bỏ qua.
+func (r *crawlRun) retryFailures() error {
+	if len(r.cp.FailedPages) == 0 && len(r.cp.FailedDetails) == 0 {
 		return nil
 	}
+	log.Printf("[%s] retry pass: %d failed pages, %d failed details", r.tag, len(r.cp.FailedPages), len(r.cp.FailedDetails))
 
-	// JSONL: append từng dòng
-	if strings.HasSuffix(strings.ToLower(path), ".jsonl") {
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	for _, p := range slices.Sorted(maps.Keys(r.cp.FailedPages)) {
+		if r.full() || r.stopped() {
+			return nil
+		}
+		if f := r.cp.FailedPages[p]; f.Attempts >= r.cfg.MaxAttempts {
+			log.Printf("[%s] give up page %d after %d attempts: %s", r.tag, p, f.Attempts, f.Error)
+			continue
+		}
+		doc, err := r.fetchList(p)
 		if err != nil {
+			if r.stopped() {
+				return nil
+			}
+			log.Printf("[%s] retry page %d: %v", r.tag, p, err)
+			r.cp.failPage(p, err)
+			r.saveCheckpoint()
+			continue
+		}
+		links, thumbs := r.src.ExtractDetailLinks(doc)
+		r.processDetails(p, r.allowedLinks(links), thumbs)
+		if err := r.flush(); err != nil {
 			return err
 		}
-		defer f.Close()
-
-		w := bufio.NewWriter(f)
-		enc := json.NewEncoder(w)
-		for _, it := range items {
-			if err := enc.Encode(it); err != nil {
-				return err
-			}
+		if r.stopped() {
+			r.saveCheckpoint()
+			return nil
 		}
-		return w.Flush()
+		r.cp.donePage(p)
+		r.saveCheckpoint()
 	}
 
-	// JSON array: nạp cũ -> thêm -> sort -> ghi lại
-	existing, _ := loadItems(path)
-	existing = append(existing, items...)
-
-	// optional: sort by Title để file ổn định
-	sort.Slice(existing, func(i, j int) bool {
-		return strings.ToLower(existing[i].Title) < strings.ToLower(existing[j].Title)
-	})
+	var urls []string
+	for _, u := range slices.Sorted(maps.Keys(r.cp.FailedDetails)) {
+		if f := r.cp.FailedDetails[u]; f.Attempts >= r.cfg.MaxAttempts {
+			log.Printf("  [%s/detail] give up %s after %d attempts: %s", r.tag, u, f.Attempts, f.Error)
+			continue
+		}
+		urls = append(urls, u)
+	}
+	if len(urls) > 0 && !r.full() && !r.stopped() {
+		// trang list gốc không còn -> không có thumbnail fallback;
+		// page = 0 để giữ nguyên số trang đã ghi trong checkpoint
+		r.processDetails(0, r.allowedLinks(urls), nil)
+		if err := r.flush(); err != nil {
+			return err
+		}
+		r.saveCheckpoint()
+	}
+	return nil
+}
 
-	tmp := path + ".tmp"
-	f, err := os.Create(tmp)
-	if err != nil {
-		return err
+func (r *crawlRun) flush() error {
+	if len(r.updates) > 0 {
+		if err := r.store.Upsert(r.updates...); err != nil {
+			return err
+		}
+		r.updates = r.updates[:0]
 	}
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(existing); err != nil {
-		f.Close()
-		_ = os.Remove(tmp)
-		return err
+	if len(r.batch) == 0 {
+		return nil
 	}
-	if err := f.Close(); err != nil {
+	if err := r.store.Append(r.batch...); err != nil {
 		return err
 	}
-	return os.Rename(tmp, path)
+	r.batch = r.batch[:0]
+	return nil
 }
 
-// ---- dùng lại fetchDoc nhưng đảm bảo User-Agent ----
+// saveCheckpoint: incremental chạy từ trang 1 nên không được ghi đè
+// checkpoint của lần full crawl.
+func (r *crawlRun) saveCheckpoint() {
+	if r.cfg.Incremental {
+		return
+	}
+	if err := writeCheckpoint(r.cfg.CPPath, &r.cp); err != nil {
+		log.Printf("[%s] warn write checkpoint: %v", r.tag, err)
+	}
+}
+
+// detailResult: kết quả parse một trang chi tiết.
+type detailResult struct {
+	url   string
+	items []Item
+	err   error
+}
+
+// fetchDetails: parse các trang chi tiết bằng worker pool; kết quả trả về
+// đúng thứ tự urls để file JSONL ổn định giữa các lần chạy.
+// Tốc độ thực tế do rate limiter trong client quyết định. ctx bị huỷ thì
+// URL chưa kịp chạy trả về lỗi ctx (không bị đánh dấu xong).
+func fetchDetails(ctx context.Context, src Source, client Fetcher, urls []string, workers int) []detailResult {
+	results := make([]detailResult, len(urls))
+	err := forEachParallel(ctx, len(urls), workers, func(i int) {
+		items, err := src.ParseDetail(client, urls[i])
+		results[i] = detailResult{url: urls[i], items: items, err: err}
+	})
+	if err != nil {
+		for i := range results {
+			if results[i].url == "" {
+				results[i] = detailResult{url: urls[i], err: err}
+			}
+		}
+	}
+	return results
+}
+
+// ---- fetch với User-Agent của từng source ----
+
+func fetchDoc(client Fetcher, u string) (*goquery.Document, error) {
+	return fetchDocUA(client, u, userAgent)
+}
 
-func fetchDoc(client *http.Client, u string) (*goquery.Document, error) {
+func fetchDocUA(client Fetcher, u, ua string) (*goquery.Document, error) {
 	req, _ := http.NewRequest("GET", u, nil)
-	req.Header.Set("User-Agent", userAgent) // hoặc cfg.UserAgent nếu bạn muốn
+	req.Header.Set("User-Agent", ua)
 	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
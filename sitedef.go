@@ -0,0 +1,373 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// siteDef: mô tả một site bằng file JSON (thư mục -sites) để thêm site mới
+// không cần viết Go. sites/kiddo.json và sites/worksheetfun.json tái hiện
+// đúng hành vi của kiddoSource và wsfSource.
+type siteDef struct {
+	Name      string `json:"name"`
+	BaseURL   string `json:"base_url"`
+	UserAgent string `json:"user_agent,omitempty"`
+	Sitemap   string `json:"sitemap,omitempty"` // mặc định base_url + /sitemap.xml
+
+	List struct {
+		FirstPage       string `json:"first_page"`                  // URL trang 1
+		PagePattern     string `json:"page_pattern"`                // URL trang N, {page} = số trang
+		MaxPageSelector string `json:"max_page_selector,omitempty"` // anchor phân trang
+		MaxPageRegex    string `json:"max_page_regex,omitempty"`    // group 1 = số trang
+		Lazy            bool   `json:"lazy,omitempty"`              // cào tới khi hết bài, không dò max page
+		LazyCustomURL   bool   `json:"lazy_custom_url,omitempty"`   // lazy khi người dùng truyền list URL riêng
+	} `json:"list"`
+
+	DetailLinks struct {
+		Selectors []string `json:"selectors"`       // anchor dẫn vào trang chi tiết, theo thứ tự
+		Thumb     string   `json:"thumb,omitempty"` // <img> trong anchor làm thumbnail fallback
+	} `json:"detail_links"`
+
+	URLRules urlRules `json:"url_rules"`
+
+	Detail struct {
+		DirectPDF    bool        `json:"direct_pdf,omitempty"` // link chi tiết đuôi .pdf -> thành item luôn
+		Title        []fieldRule `json:"title"`
+		TitleFromURL bool        `json:"title_from_url,omitempty"` // title rỗng -> lấy từ slug URL
+		PDF          pdfRule     `json:"pdf"`
+		Image        []fieldRule `json:"image"`
+		Subject      []fieldRule `json:"subject"`
+		Tags         []fieldRule `json:"tags,omitempty"` // gom giá trị của mọi phần tử khớp mọi rule
+	} `json:"detail"`
+}
+
+// urlRules: lọc link chi tiết (so sánh chữ thường).
+type urlRules struct {
+	Hosts           []string `json:"hosts,omitempty"`            // host phải chứa một trong các chuỗi
+	Include         []string `json:"include,omitempty"`          // URL phải chứa ít nhất một chuỗi (rỗng = mọi URL)
+	Exclude         []string `json:"exclude,omitempty"`          // URL chứa chuỗi này thì loại
+	ExcludePrefixes []string `json:"exclude_prefixes,omitempty"` // ví dụ mailto:, javascript:
+	ExcludeSuffixes []string `json:"exclude_suffixes,omitempty"` // đuôi path, ví dụ .jpg
+}
+
+// fieldRule: một cách lấy giá trị; các rule được thử lần lượt tới khi có giá trị.
+type fieldRule struct {
+	Selector string `json:"selector"`
+	Attr     string `json:"attr,omitempty"`   // rỗng = lấy text
+	Label    string `json:"label,omitempty"`  // chỉ nhận phần tử có text bắt đầu bằng label, lấy phần sau ':'
+	Parent   bool   `json:"parent,omitempty"` // label nằm trong <strong>/<b>: đọc text của node cha, rỗng thì node kế
+	Pick     string `json:"pick,omitempty"`   // "likely_subject": gom mọi giá trị rồi pickLikelySubject
+}
+
+// pdfRule: mọi anchor có href theo suffix (mỗi link một item); không có
+// thì anchor đầu tiên có text chứa từ khoá.
+type pdfRule struct {
+	Selector     string   `json:"selector,omitempty"` // mặc định a[href]
+	Suffixes     []string `json:"suffixes"`
+	TextContains []string `json:"text_contains,omitempty"`
+}
+
+// loadSiteDefs đọc mọi *.json trong dir và đăng ký thành Source;
+// trùng tên với source có sẵn thì định nghĩa trong file thắng.
+func loadSiteDefs(dir string) error {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	for _, fn := range files {
+		def, err := readSiteDef(fn)
+		if err != nil {
+			return fmt.Errorf("%s: %w", fn, err)
+		}
+		registerSource(def.Name, func(listURL string) Source { return newDeclSource(def, listURL) })
+		log.Printf("[sites] loaded %s from %s", def.Name, fn)
+	}
+	return nil
+}
+
+func readSiteDef(path string) (*siteDef, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var def siteDef
+	if err := json.Unmarshal(b, &def); err != nil {
+		return nil, err
+	}
+	def.Name = strings.ToLower(strings.TrimSpace(def.Name))
+	switch {
+	case def.Name == "":
+		return nil, fmt.Errorf("missing name")
+	case def.BaseURL == "":
+		return nil, fmt.Errorf("missing base_url")
+	case def.List.FirstPage == "" || !strings.Contains(def.List.PagePattern, "{page}"):
+		return nil, fmt.Errorf("list.first_page and list.page_pattern (with {page}) are required")
+	case len(def.DetailLinks.Selectors) == 0:
+		return nil, fmt.Errorf("detail_links.selectors is empty")
+	}
+	if def.List.MaxPageRegex != "" {
+		if _, err := regexp.Compile(def.List.MaxPageRegex); err != nil {
+			return nil, fmt.Errorf("list.max_page_regex: %w", err)
+		}
+	}
+	if def.UserAgent == "" {
+		def.UserAgent = "WorksheetCrawler/1.0 (+https://example.local)"
+	}
+	if def.Detail.PDF.Selector == "" {
+		def.Detail.PDF.Selector = "a[href]"
+	}
+	return &def, nil
+}
+
+// declSource: Source chạy theo siteDef bằng goquery.
+type declSource struct {
+	def         *siteDef
+	firstPage   string
+	pagePattern string
+	lazy        bool
+}
+
+// newDeclSource: listURL (nếu có) thay cho list của định nghĩa, phân trang
+// kiểu WordPress .../page/N/ giống wsfCatPageURL.
+func newDeclSource(def *siteDef, listURL string) *declSource {
+	s := &declSource{def: def, firstPage: def.List.FirstPage, pagePattern: def.List.PagePattern, lazy: def.List.Lazy}
+	if listURL = strings.TrimSpace(listURL); listURL != "" {
+		if strings.Contains(listURL, "{page}") {
+			s.pagePattern = listURL
+		} else {
+			s.pagePattern = regexp.MustCompile(`/page/\d+/`).ReplaceAllString(wsfNormalizeCatURL(listURL), "/page/{page}/")
+		}
+		s.firstPage = strings.ReplaceAll(s.pagePattern, "{page}", "1")
+		s.lazy = s.lazy || def.List.LazyCustomURL
+	}
+	return s
+}
+
+func (s *declSource) Name() string      { return s.def.Name }
+func (s *declSource) UserAgent() string { return s.def.UserAgent }
+func (s *declSource) Lazy() bool        { return s.lazy }
+
+func (s *declSource) ListURL(p int) string {
+	if p <= 1 {
+		return s.firstPage
+	}
+	return strings.ReplaceAll(s.pagePattern, "{page}", strconv.Itoa(p))
+}
+
+func (s *declSource) FindMaxPages(client Fetcher) (int, error) {
+	doc, err := fetchDocUA(client, s.ListURL(1), s.def.UserAgent)
+	if err != nil {
+		return 0, err
+	}
+	max := 1
+	if s.def.List.MaxPageSelector == "" || s.def.List.MaxPageRegex == "" {
+		return max, nil
+	}
+	re := regexp.MustCompile(s.def.List.MaxPageRegex)
+	doc.Find(s.def.List.MaxPageSelector).Each(func(_ int, a *goquery.Selection) {
+		if href, ok := a.Attr("href"); ok {
+			if m := re.FindStringSubmatch(href); len(m) >= 2 {
+				if n := atoiSafe(m[1]); n > max {
+					max = n
+				}
+			}
+		}
+	})
+	return max, nil
+}
+
+func (s *declSource) SitemapURL() string {
+	if s.def.Sitemap != "" {
+		return s.def.Sitemap
+	}
+	return strings.TrimSuffix(s.def.BaseURL, "/") + "/sitemap.xml"
+}
+
+func (s *declSource) abs(href string) string {
+	u, err := url.Parse(href)
+	if err != nil || u.IsAbs() {
+		return href
+	}
+	base, err := url.Parse(s.def.BaseURL)
+	if err != nil {
+		return href
+	}
+	return base.ResolveReference(u).String()
+}
+
+func (s *declSource) IsDetailURL(href string) bool {
+	rules := s.def.URLRules
+	h := strings.ToLower(href)
+	for _, p := range rules.ExcludePrefixes {
+		if strings.HasPrefix(h, strings.ToLower(p)) {
+			return false
+		}
+	}
+	if len(rules.Hosts) > 0 || len(rules.ExcludeSuffixes) > 0 {
+		u, err := url.Parse(h)
+		if err != nil {
+			return false
+		}
+		if len(rules.Hosts) > 0 && !containsAny(u.Host, lowerAll(rules.Hosts)) {
+			return false
+		}
+		for _, suf := range rules.ExcludeSuffixes {
+			if strings.HasSuffix(u.Path, strings.ToLower(suf)) {
+				return false
+			}
+		}
+	}
+	if containsAny(h, lowerAll(rules.Exclude)) {
+		return false
+	}
+	return len(rules.Include) == 0 || containsAny(h, lowerAll(rules.Include))
+}
+
+func (s *declSource) ExtractDetailLinks(doc *goquery.Document) ([]string, map[string]string) {
+	var links []string
+	thumbByDetail := map[string]string{}
+	for _, sel := range s.def.DetailLinks.Selectors {
+		doc.Find(sel).Each(func(_ int, a *goquery.Selection) {
+			href, _ := a.Attr("href")
+			abs := s.abs(href)
+			if !s.IsDetailURL(abs) {
+				return
+			}
+			links = append(links, abs)
+			if s.def.DetailLinks.Thumb == "" {
+				return
+			}
+			if img := a.Find(s.def.DetailLinks.Thumb); img.Length() > 0 {
+				if src, ok := img.Attr("src"); ok && src != "" {
+					thumbByDetail[abs] = s.abs(src)
+				}
+			}
+		})
+	}
+	return uniq(links), thumbByDetail
+}
+
+func (s *declSource) ParseDetail(client Fetcher, detailURL string) ([]Item, error) {
+	d := s.def.Detail
+	if d.DirectPDF && strings.HasSuffix(strings.ToLower(detailURL), ".pdf") {
+		return []Item{{Title: fallbackTitle(detailURL), PDFURL: detailURL, URL: detailURL}}, nil
+	}
+
+	doc, err := fetchDocUA(client, detailURL, s.def.UserAgent)
+	if err != nil {
+		return nil, err
+	}
+
+	title := s.extract(doc, d.Title)
+	if title == "" && d.TitleFromURL {
+		title = fallbackTitle(detailURL)
+	}
+	img := s.extract(doc, d.Image)
+	if img != "" {
+		img = s.abs(img)
+	}
+
+	rule := d.PDF
+	pdfs := collectPDFLinks(doc, rule.Selector, lowerAll(rule.Suffixes), lowerAll(rule.TextContains), s.abs)
+	return pdfItems(Item{
+		Title:   title,
+		IMGURL:  img,
+		URL:     detailURL,
+		Subject: s.extract(doc, d.Subject),
+		Tags:    s.extractAll(doc, d.Tags),
+	}, pdfs), nil
+}
+
+// extract chạy lần lượt các rule, trả giá trị đầu tiên khác rỗng.
+func (s *declSource) extract(doc *goquery.Document, rules []fieldRule) string {
+	for _, r := range rules {
+		if v := r.apply(doc); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// extractAll: mọi giá trị khác rỗng của mọi rule (dùng cho tags).
+func (s *declSource) extractAll(doc *goquery.Document, rules []fieldRule) []string {
+	var out []string
+	for _, r := range rules {
+		doc.Find(r.Selector).Each(func(_ int, e *goquery.Selection) {
+			if v := r.value(e); v != "" {
+				out = append(out, v)
+			}
+		})
+	}
+	return out
+}
+
+func (r fieldRule) apply(doc *goquery.Document) string {
+	sel := doc.Find(r.Selector)
+
+	switch {
+	case r.Pick == "likely_subject":
+		var cands []string
+		sel.Each(func(_ int, e *goquery.Selection) {
+			if v := r.value(e); v != "" {
+				cands = append(cands, v)
+			}
+		})
+		if v := pickLikelySubject(cands); v != "" {
+			return v
+		}
+		if len(cands) > 0 {
+			return cands[0]
+		}
+		return ""
+
+	case r.Label != "":
+		label := strings.ToLower(r.Label)
+		out := ""
+		sel.EachWithBreak(func(_ int, e *goquery.Selection) bool {
+			if !strings.HasPrefix(strings.ToLower(strings.TrimSpace(e.Text())), label) {
+				return true
+			}
+			if !r.Parent {
+				out = strings.TrimSpace(afterColon(cleanText(e.Text())))
+				return out == ""
+			}
+			out = strings.TrimSpace(afterColon(cleanText(e.Parent().Text())))
+			if out == "" {
+				if sib := e.Parent().Next(); sib.Length() > 0 {
+					out = cleanText(sib.Text())
+				}
+			}
+			return out == ""
+		})
+		return out
+	}
+	return r.value(sel.First())
+}
+
+func (r fieldRule) value(e *goquery.Selection) string {
+	if e.Length() == 0 {
+		return ""
+	}
+	if r.Attr != "" {
+		v, _ := e.Attr(r.Attr)
+		return strings.TrimSpace(v)
+	}
+	return cleanText(e.Text())
+}
+
+func lowerAll(ss []string) []string {
+	out := make([]string, len(ss))
+	for i, s := range ss {
+		out[i] = strings.ToLower(s)
+	}
+	return out
+}
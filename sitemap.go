@@ -0,0 +1,184 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+)
+
+// sitemapSource: source có sitemap.xml (WordPress) để dùng Discovery = "sitemap"
+// thay cho việc duyệt trang list và đoán số trang.
+type sitemapSource interface {
+	SitemapURL() string
+	IsDetailURL(u string) bool
+}
+
+type sitemapEntry struct {
+	Loc     string `xml:"loc"`
+	LastMod string `xml:"lastmod"`
+}
+
+// sitemapDoc đọc được cả <urlset> lẫn <sitemapindex>.
+type sitemapDoc struct {
+	URLs     []sitemapEntry `xml:"url"`
+	Sitemaps []sitemapEntry `xml:"sitemap"`
+}
+
+// sitemap con chứa trang taxonomy, không phải bài -> bỏ qua
+var sitemapSkipWords = []string{"category", "tag", "author", "taxonom"}
+
+// collectSitemap đọc sitemap (hoặc sitemap index, kể cả .gz) và trả mọi <url>.
+func collectSitemap(client Fetcher, root, ua string) ([]sitemapEntry, error) {
+	var out []sitemapEntry
+	visited := map[string]bool{}
+
+	var walk func(u string, depth int) error
+	walk = func(u string, depth int) error {
+		if visited[u] || depth > 3 {
+			return nil
+		}
+		visited[u] = true
+
+		body, err := fetchBytes(client, u, ua)
+		if err != nil {
+			return err
+		}
+		var doc sitemapDoc
+		if err := xml.Unmarshal(body, &doc); err != nil {
+			return fmt.Errorf("sitemap %s: %w", u, err)
+		}
+		out = append(out, doc.URLs...)
+		for _, sm := range doc.Sitemaps {
+			loc := strings.TrimSpace(sm.Loc)
+			if loc == "" || containsAny(strings.ToLower(loc), sitemapSkipWords) {
+				continue
+			}
+			if err := walk(loc, depth+1); err != nil {
+				// một sitemap con lỗi không làm hỏng cả lần discovery
+				log.Printf("[sitemap] skip %s: %v", loc, err)
+			}
+		}
+		return nil
+	}
+	if err := walk(root, 0); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// fetchBytes tải nguyên body; tự giải nén nếu là file gzip (sitemap.xml.gz).
+func fetchBytes(client Fetcher, u, ua string) ([]byte, error) {
+	req, _ := http.NewRequest("GET", u, nil)
+	req.Header.Set("User-Agent", ua)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("http %d", resp.StatusCode)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 64<<20))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > 2 && body[0] == 0x1f && body[1] == 0x8b {
+		zr, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		defer zr.Close()
+		return io.ReadAll(io.LimitReader(zr, 256<<20))
+	}
+	return body, nil
+}
+
+func containsAny(s string, subs []string) bool {
+	for _, sub := range subs {
+		if strings.Contains(s, sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// crawlSitemap: discovery qua sitemap. Detail URL đã biết mà lastmod không
+// đổi so với lần trước thì bỏ qua; URL đã biết nhưng chưa có lastmod (data
+// cào từ trang list trước đây) chỉ được ghi nhận lastmod, không tải lại.
+// URL đã biết có lastmod đổi được tải lại và item của nó Upsert theo pdf_url.
+func (r *crawlRun) crawlSitemap() error {
+	sm, ok := r.src.(sitemapSource)
+	if !ok {
+		return fmt.Errorf("source %s does not support sitemap discovery", r.tag)
+	}
+	root := r.cfg.SitemapURL
+	if root == "" {
+		root = sm.SitemapURL()
+	}
+	log.Printf("[%s] sitemap discovery: %s data=%s cp=%s", r.tag, root, r.cfg.DataPath, r.cfg.CPPath)
+
+	entries, err := collectSitemap(r.client, root, r.ua)
+	if err != nil {
+		return err
+	}
+	if r.cp.SitemapLastmod == nil {
+		r.cp.SitemapLastmod = map[string]string{}
+	}
+
+	var todo []string
+	lastmod := map[string]string{}
+	unchanged := 0
+	for _, e := range entries {
+		loc := strings.TrimSpace(e.Loc)
+		if loc == "" || !sm.IsDetailURL(loc) {
+			continue
+		}
+		if _, dup := lastmod[loc]; dup {
+			continue
+		}
+		mod := strings.TrimSpace(e.LastMod)
+		lastmod[loc] = mod
+
+		if _, known := r.knownDetail[loc]; known {
+			prev, had := r.cp.SitemapLastmod[loc]
+			if !had || r.cfg.Incremental || prev == mod {
+				r.cp.SitemapLastmod[loc] = mod
+				unchanged++
+				continue
+			}
+			r.refetch[loc] = struct{}{}
+		}
+		todo = append(todo, loc)
+	}
+	log.Printf("[%s] sitemap: %d entries, %d detail URLs to fetch, %d unchanged", r.tag, len(entries), len(todo), unchanged)
+
+	todo = r.allowedLinks(todo)
+	const chunkSize = 50
+	for i := 0; i < len(todo) && !r.full() && !r.stopped(); i += chunkSize {
+		chunk := todo[i:min(i+chunkSize, len(todo))]
+		r.processDetails(0, chunk, nil)
+		if err := r.flush(); err != nil {
+			return err
+		}
+		if r.stopped() {
+			// chunk dở: không ghi lastmod, URL chưa xử lý sẽ được tải lại lần sau
+			break
+		}
+		// chỉ ghi lastmod cho URL xử lý thành công; URL lỗi để retry pass lo
+		for _, u := range chunk {
+			if _, failed := r.cp.FailedDetails[u]; !failed {
+				r.cp.SitemapLastmod[u] = lastmod[u]
+				r.knownDetail[u] = struct{}{}
+			}
+		}
+		r.saveCheckpoint()
+		r.report(0)
+	}
+	r.saveCheckpoint()
+	return nil
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// sitemapTestSource: source tối giản cho test discovery qua sitemap;
+// mỗi trang /d/<x> có một PDF /files/<x>.pdf, title lấy từ <h1>.
+type sitemapTestSource struct{ base string }
+
+func (s sitemapTestSource) Name() string                      { return "smtest" }
+func (s sitemapTestSource) UserAgent() string                 { return "test" }
+func (s sitemapTestSource) ListURL(p int) string              { return fmt.Sprintf("%s/list/%d", s.base, p) }
+func (s sitemapTestSource) FindMaxPages(Fetcher) (int, error) { return 1, nil }
+func (s sitemapTestSource) SitemapURL() string                { return s.base + "/sitemap.xml" }
+func (s sitemapTestSource) IsDetailURL(u string) bool         { return strings.Contains(u, "/d/") }
+
+func (s sitemapTestSource) ExtractDetailLinks(*goquery.Document) ([]string, map[string]string) {
+	return nil, nil
+}
+
+func (s sitemapTestSource) ParseDetail(client Fetcher, u string) ([]Item, error) {
+	doc, err := fetchDoc(client, u)
+	if err != nil {
+		return nil, err
+	}
+	return []Item{{
+		Title:  strings.TrimSpace(doc.Find("h1").Text()),
+		PDFURL: s.base + "/files/" + filepath.Base(u) + ".pdf",
+		URL:    u,
+	}}, nil
+}
+
+// lastmod đổi: trang được tải lại và item cũ được thay (Upsert), không bị
+// bỏ vì trùng pdf_url.
+func TestCrawlSitemapRefreshesChangedEntries(t *testing.T) {
+	var mu sync.Mutex
+	lastmod, title := "2024-01-01", "Old title"
+	hits := map[string]int{}
+	var srv *httptest.Server
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		hits[r.URL.Path]++
+		switch r.URL.Path {
+		case "/sitemap.xml":
+			fmt.Fprintf(w, `<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">`+
+				`<url><loc>%[1]s/d/a</loc><lastmod>%[2]s</lastmod></url>`+
+				`<url><loc>%[1]s/d/b</loc><lastmod>2024-01-01</lastmod></url></urlset>`, srv.URL, lastmod)
+		case "/d/a":
+			fmt.Fprintf(w, `<h1>%s</h1>`, title)
+		case "/d/b":
+			fmt.Fprint(w, `<h1>Unchanged</h1>`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer srv.Close()
+
+	for _, file := range []string{"items.jsonl", "items.json", "items.db"} {
+		t.Run(file, func(t *testing.T) {
+			mu.Lock()
+			lastmod, title = "2024-01-01", "Old title"
+			clear(hits)
+			mu.Unlock()
+			dir := t.TempDir()
+			cfg := CrawlConfig{DataPath: filepath.Join(dir, file), CPPath: filepath.Join(dir, "cp.json"), Discovery: "sitemap"}
+			src := sitemapTestSource{srv.URL}
+			if err := RunCrawl(context.Background(), src, cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			mu.Lock()
+			lastmod, title = "2024-03-01", "New title"
+			mu.Unlock()
+			if err := RunCrawl(context.Background(), src, cfg); err != nil {
+				t.Fatal(err)
+			}
+
+			items, err := loadItems(cfg.DataPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			titles := map[string]string{}
+			for _, it := range items {
+				titles[filepath.Base(it.URL)] = it.Title
+			}
+			if len(items) != 2 || titles["a"] != "New title" || titles["b"] != "Unchanged" {
+				t.Errorf("items = %+v, want a refreshed to New title and b unchanged", items)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			if hits["/d/a"] != 2 || hits["/d/b"] != 1 {
+				t.Errorf("hits /d/a = %d, /d/b = %d; want 2 and 1", hits["/d/a"], hits["/d/b"])
+			}
+		})
+	}
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// Source mô tả một site worksheet mà crawl engine (RunCrawl) có thể chạy.
+// Mỗi site chỉ cần khai báo cách phân trang list, cách lấy link chi tiết
+// và cách parse trang chi tiết; vòng lặp list -> detail -> dedup -> append
+// -> checkpoint nằm chung ở runner.go.
+type Source interface {
+	// Name: tên ngắn dùng cho -sources và prefix log, ví dụ "kiddo".
+	Name() string
+	// UserAgent gửi kèm mọi request của source này.
+	UserAgent() string
+	// ListURL trả URL trang list thứ p (p >= 1).
+	ListURL(p int) string
+	// FindMaxPages dò số trang list lớn nhất (dùng khi EndPage = 0).
+	FindMaxPages(client Fetcher) (int, error)
+	// ExtractDetailLinks lấy link chi tiết trên trang list, kèm map
+	// detail URL -> thumbnail để bù khi trang chi tiết không có ảnh.
+	ExtractDetailLinks(doc *goquery.Document) ([]string, map[string]string)
+	// ParseDetail tải và parse một trang chi tiết; trang có nhiều PDF
+	// trả về một Item cho mỗi PDF (chung img/subject/detail_url).
+	ParseDetail(client Fetcher, detailURL string) ([]Item, error)
+}
+
+// lazyPager: source nào muốn cào kiểu "tăng /page/N/ tới khi hết bài"
+// (không dò max page) thì implement thêm interface này.
+type lazyPager interface {
+	Lazy() bool
+}
+
+// SourceFactory tạo Source; listURL là URL list tuỳ chọn do người dùng
+// truyền vào (ví dụ category của worksheetfun), rỗng = mặc định của site.
+type SourceFactory func(listURL string) Source
+
+var sourceRegistry = map[string]SourceFactory{}
+
+func registerSource(name string, f SourceFactory) {
+	sourceRegistry[name] = f
+}
+
+func newSource(name, listURL string) (Source, error) {
+	f, ok := sourceRegistry[strings.ToLower(strings.TrimSpace(name))]
+	if !ok {
+		return nil, fmt.Errorf("unknown source %q (available: %s)", name, strings.Join(sourceNames(), ", "))
+	}
+	return f(listURL), nil
+}
+
+func sourceNames() []string {
+	names := make([]string, 0, len(sourceRegistry))
+	for n := range sourceRegistry {
+		names = append(names, n)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+	"unicode"
+)
+
+// Bảng chuẩn hoá subject/tag, áp lúc crawl (processDetails) và khi chạy
+// migration -migrate_subjects trên file data cũ. Có thể mở rộng bằng file
+// JSON qua -subject_map (cùng cấu trúc subjectMap).
+type subjectMap struct {
+	// Aliases: khoá chữ thường -> tên chuẩn, ví dụ "maths" -> "Math"
+	Aliases map[string]string `json:"aliases"`
+	// StripPrefixes: nhãn bị dính vào giá trị, ví dụ "Subject Coloring"
+	StripPrefixes []string `json:"strip_prefixes"`
+	// Drop: tag vô nghĩa (category chung của site)
+	Drop []string `json:"drop"`
+}
+
+var subjectTable = subjectMap{
+	Aliases: map[string]string{
+		"math":                  "Math",
+		"maths":                 "Math",
+		"mathematics":           "Math",
+		"english":               "English",
+		"ela":                   "English",
+		"english language arts": "English",
+		"language arts":         "English",
+		"colouring":             "Coloring",
+		"coloring pages":        "Coloring",
+		"colours":               "Colors",
+		"abc":                   "Alphabet",
+		"abcs":                  "Alphabet",
+		"sight word":            "Sight Words",
+		"sightwords":            "Sight Words",
+		"number":                "Numbers",
+		"shape":                 "Shapes",
+		"handwriting":           "Writing",
+		"science worksheets":    "Science",
+		"social study":          "Social Studies",
+	},
+	StripPrefixes: []string{"subjects", "subject", "categories", "category", "topics", "topic"},
+	Drop:          []string{"uncategorized", "all downloads", "downloads", "worksheets", "printables", "free", "blog"},
+}
+
+// loadSubjectMap gộp file JSON vào bảng mặc định (trùng khoá thì file thắng).
+func loadSubjectMap(path string) error {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var m subjectMap
+	if err := json.Unmarshal(b, &m); err != nil {
+		return err
+	}
+	for k, v := range m.Aliases {
+		subjectTable.Aliases[strings.ToLower(strings.TrimSpace(k))] = v
+	}
+	subjectTable.StripPrefixes = append(m.StripPrefixes, subjectTable.StripPrefixes...)
+	subjectTable.Drop = append(subjectTable.Drop, lowerAll(m.Drop)...)
+	return nil
+}
+
+// normalizeSubject: bỏ nhãn "Subject"/"Category" dính ở đầu, gộp khoảng
+// trắng, tra alias (không phân biệt hoa thường), còn lại viết hoa chữ đầu.
+// Trả "" nếu giá trị nằm trong danh sách Drop.
+func normalizeSubject(s string) string {
+	s = cleanText(s)
+	for {
+		l := strings.ToLower(s)
+		stripped := false
+		for _, p := range subjectTable.StripPrefixes {
+			p = strings.ToLower(p)
+			if !strings.HasPrefix(l, p) {
+				continue
+			}
+			rest := s[len(p):]
+			// chỉ bỏ nếu là cả từ: "Subject: Math", "Subject Coloring", không phải "Subtraction"
+			if rest != "" && unicode.IsLetter(rune(rest[0])) {
+				continue
+			}
+			s = strings.TrimLeft(rest, " :-–|>")
+			stripped = true
+			break
+		}
+		if !stripped {
+			break
+		}
+	}
+	s = strings.Trim(s, " .,;:-")
+	if s == "" {
+		return ""
+	}
+	l := strings.ToLower(s)
+	for _, d := range subjectTable.Drop {
+		if l == d {
+			return ""
+		}
+	}
+	if v, ok := subjectTable.Aliases[l]; ok {
+		return v
+	}
+	return titleWords(l)
+}
+
+// titleWords: "sight words" -> "Sight Words" (giữ chữ thường cho từ nối).
+func titleWords(s string) string {
+	words := strings.Fields(s)
+	for i, w := range words {
+		if i > 0 && (w == "and" || w == "of" || w == "the" || w == "for" || w == "in") {
+			continue
+		}
+		r := []rune(w)
+		r[0] = unicode.ToUpper(r[0])
+		words[i] = string(r)
+	}
+	return strings.Join(words, " ")
+}
+
+// normalizeTags chuẩn hoá từng giá trị (tách "Math, Coloring"), bỏ trùng,
+// giữ thứ tự xuất hiện.
+func normalizeTags(vals []string) []string {
+	var out []string
+	seen := map[string]bool{}
+	for _, v := range vals {
+		for _, part := range strings.FieldsFunc(v, func(r rune) bool { return r == ',' || r == ';' || r == '|' }) {
+			t := normalizeSubject(part)
+			if t == "" || seen[strings.ToLower(t)] {
+				continue
+			}
+			seen[strings.ToLower(t)] = true
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// normalizeItemSubjects: subject chính đã chuẩn hoá + tags (subject chính
+// đứng đầu). Subject trống thì chọn từ tags theo pickLikelySubject.
+func normalizeItemSubjects(it Item) Item {
+	tags := normalizeTags(append([]string{it.Subject}, it.Tags...))
+	primary := ""
+	if parts := normalizeTags([]string{it.Subject}); len(parts) > 0 {
+		primary = parts[0]
+	} else if s := pickLikelySubject(tags); s != "" {
+		primary = s
+	} else if len(tags) > 0 {
+		primary = tags[0]
+	}
+	if primary != "" && (len(tags) == 0 || tags[0] != primary) {
+		rest := tags[:0:0]
+		for _, t := range tags {
+			if t != primary {
+				rest = append(rest, t)
+			}
+		}
+		tags = append([]string{primary}, rest...)
+	}
+	it.Subject, it.Tags = primary, tags
+	return it
+}
+
+// migrateSubjects: migration một lần cho file data cũ.
+func migrateSubjects(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	st, err := openItemStore(path)
+	if err != nil {
+		return err
+	}
+	items, err := st.Load()
+	if err != nil {
+		st.Close()
+		return err
+	}
+	var changed []Item
+	keys := map[string]bool{}
+	dupKeys := false
+	for i, it := range items {
+		n := normalizeItemSubjects(it)
+		if n.Subject != it.Subject || strings.Join(n.Tags, "\x00") != strings.Join(it.Tags, "\x00") {
+			changed = append(changed, n)
+		}
+		dupKeys = dupKeys || keys[itemKey(it)]
+		keys[itemKey(it)] = true
+		items[i] = n
+	}
+	log.Printf("[subjects] %s: %d items, %d changed", path, len(items), len(changed))
+	if dupKeys {
+		// file cat từ nhiều nguồn lặp pdf_url: Upsert theo khoá không phân biệt được
+		st.Close()
+		return writeItemsAtomic(path, items)
+	}
+	if err := st.Upsert(changed...); err != nil {
+		st.Close()
+		return err
+	}
+	return st.Close()
+}
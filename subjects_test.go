@@ -0,0 +1,49 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+)
+
+func TestMigrateSubjects(t *testing.T) {
+	a := Item{Title: "A", PDFURL: "https://x/a.pdf", Subject: "maths", Tags: []string{"maths", "Worksheets"}}
+	b := Item{Title: "B", PDFURL: "https://x/b.pdf"}
+	aAgain := Item{Title: "A again", PDFURL: "https://x/a.pdf", Subject: "maths"}
+	tests := []struct {
+		name string
+		file string
+		in   []Item
+	}{
+		{"jsonl", "items.jsonl", []Item{a, b}},
+		{"json", "items.json", []Item{a, b}},
+		{"kv", "items.db", []Item{a, b}},
+		{"jsonl with repeated pdf_url", "items.jsonl", []Item{a, b, aAgain}}, // cat kiddo + wsfun
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), tc.file)
+			if err := writeItemsAtomic(path, tc.in); err != nil {
+				t.Fatal(err)
+			}
+			if err := migrateSubjects(path); err != nil {
+				t.Fatal(err)
+			}
+			got, err := loadItems(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(tc.in) {
+				t.Fatalf("got %d items, want %d: %+v", len(got), len(tc.in), got)
+			}
+			for i, it := range got {
+				want := normalizeItemSubjects(tc.in[i])
+				if it.Title != want.Title || it.Subject != want.Subject || len(it.Tags) != len(want.Tags) {
+					t.Errorf("item %d = %+v, want %+v", i, it, want)
+				}
+				if it.Subject == "maths" {
+					t.Errorf("item %d subject not normalized", i)
+				}
+			}
+		})
+	}
+}
@@ -1,8 +1,13 @@
 package main
 
-import "html/template"
+import (
+	"html/template"
+	"strings"
+)
 
 var funcMap = template.FuncMap{
+	"join":  strings.Join,
+	"lower": strings.ToLower,
 	"f64": func(n any) float64 {
 		switch v := n.(type) {
 		case int64:
@@ -48,6 +53,10 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
     .small { font-size:12px; }
     .chips { display:flex; gap:6px; flex-wrap:wrap; margin-top:6px; }
     .chip { background:#f5f5f5; border:1px solid #e9e9e9; border-radius:999px; padding:2px 8px; font-size:11px; color:#444; }
+    .chip.warn { background:#fff4e5; border-color:#ffd8a8; color:#a05a00; }
+    .card.unresolved .thumb { opacity:.5; }
+    .pager { display:flex; gap:12px; align-items:center; justify-content:center; margin:16px 0; }
+    a.btn { text-decoration:none; }
     iframe { width:100%; height:420px; border:0; border-radius:8px; }
     @media (max-width: 980px) {
       .wrap { grid-template-columns: 1fr; }
@@ -58,26 +67,34 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
 <body>
   <h1>Worksheet Picker</h1>
 
-  <div class="toolbar">
-    <input id="q" class="search" type="text" placeholder="Filter by title...">
-    <select id="subject" title="Filter by subject">
+  <form class="toolbar" id="filters" method="get" action="/">
+    <input id="q" name="q" class="search" type="text" placeholder="Filter by title..." value="{{.Query.Q}}">
+    <select id="subject" name="subject" title="Filter by subject">
       <option value="">All subjects</option>
+      {{range .Subjects}}<option value="{{.}}"{{if eq (lower .) (lower $.Query.Subject)}} selected{{end}}>{{.}}</option>{{end}}
     </select>
-    <span class="small" id="countLabel"></span>
-  </div>
+    <label class="small"><input id="hideUnresolved" name="hide_unresolved" value="1" type="checkbox"{{if .Query.HideUnresolved}} checked{{end}}> Hide items without a direct PDF</label>
+    <button type="submit" class="btn small">Filter</button>
+    <span class="small" id="selCount"></span>
+    <a href="#" class="small" id="clearSel">Clear selection</a>
+    <span class="small" id="countLabel">{{if .Total}}{{.From}}–{{.To}} of {{.Total}} items{{else}}No items{{end}}{{if ne .Total .All}} (filtered from {{.All}}){{end}}</span>
+    <span class="small muted" id="crawlStatus" data-version="{{.Version}}"></span>
+  </form>
 
   <div class="wrap">
     <div>
       <div id="list" class="list">
-        {{range .Items}}
-        <div class="card" data-title="{{.Title}}" data-pdf="{{.PDFURL}}" data-subject="{{.Subject}}">
-          <img class="thumb" loading="lazy" src="{{.IMGURL}}" alt="thumb" onerror="this.style.display='none'">
+        {{range $it := .Items}}
+        <div class="card{{if eq .PDFStatus "unresolved"}} unresolved{{end}}" data-title="{{.Title}}" data-pdf="{{.PDFURL}}" data-subject="{{.Subject}}" data-tags="{{join .Tags "|"}}" data-status="{{.PDFStatus}}">
+          <img class="thumb" loading="lazy" src="{{if $.Thumbs}}/thumb?w=400&u={{.IMGURL}}{{else}}{{.IMGURL}}{{end}}" alt="thumb" onerror="this.style.display='none'">
           <div class="meta">
             <input type="checkbox" class="pick" title="Select" />
             <div style="flex:1; min-width:0">
               <div class="title" title="{{.Title}}">{{.Title}}</div>
               <div class="chips">
                 {{if .Subject}}<span class="chip" title="Subject">{{.Subject}}</span>{{end}}
+                {{range .Tags}}{{if ne . $it.Subject}}<span class="chip" title="Tag">{{.}}</span>{{end}}{{end}}
+                {{if eq .PDFStatus "unresolved"}}<span class="chip warn" title="No direct PDF link was found for this page; merging may fail">no direct PDF</span>{{end}}
               </div>
               <div class="muted" style="word-break:break-all">{{.PDFURL}}</div>
             </div>
@@ -89,6 +106,13 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
         </div>
         {{end}}
       </div>
+      {{if gt .Pages 1}}
+      <div class="pager">
+        {{if .PrevURL}}<a class="btn small" href="{{.PrevURL}}">‹ Prev</a>{{end}}
+        <span class="small">Page {{.Page}} / {{.Pages}}</span>
+        {{if .NextURL}}<a class="btn small" href="{{.NextURL}}">Next ›</a>{{end}}
+      </div>
+      {{end}}
     </div>
 
     <div class="side">
@@ -110,17 +134,36 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
 
 <script>
   const list = document.getElementById('list');
-  const q = document.getElementById('q');
-  const subjectSel = document.getElementById('subject');
-  const label = document.getElementById('countLabel');
 
   // --- STATE PERSISTENCE ---
-  // Giữ các PDF đã chọn (theo URL) và order tương ứng, cùng tiêu đề để sort
+  // Giữ các PDF đã chọn (theo URL) và order tương ứng, cùng tiêu đề để sort.
+  // Lưu ở sessionStorage để giỏ chọn còn nguyên khi đổi trang / đổi bộ lọc.
   const selected = new Set();             // Set<string pdfUrl>
   const orderMap = new Map();             // Map<string pdfUrl, number>
   const titleMap = new Map();             // Map<string pdfUrl, string>
+  const BASKET_KEY = 'worksheetPicker.basket';
+
+  (function loadBasket(){
+    try {
+      const b = JSON.parse(sessionStorage.getItem(BASKET_KEY) || '{}');
+      (b.selected || []).forEach(pdf => selected.add(pdf));
+      Object.entries(b.order || {}).forEach(([pdf, v]) => orderMap.set(pdf, v));
+      Object.entries(b.titles || {}).forEach(([pdf, t]) => titleMap.set(pdf, t));
+    } catch (e) {}
+  })();
+
+  function saveBasket() {
+    // chỉ giữ title của item đã chọn, không để storage phình theo số trang đã xem
+    const titles = {};
+    selected.forEach(pdf => { titles[pdf] = titleMap.get(pdf) || ''; });
+    sessionStorage.setItem(BASKET_KEY, JSON.stringify({
+      selected: Array.from(selected),
+      order: Object.fromEntries(orderMap),
+      titles
+    }));
+  }
 
-  // Khởi tạo titleMap và gắn listeners cho từng card
+  // Gắn listeners cho từng card của trang hiện tại và khôi phục trạng thái
   (function initCards(){
     Array.from(list.children).forEach(card => {
       const pdf = card.getAttribute('data-pdf');
@@ -129,6 +172,8 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
 
       const cb = card.querySelector('.pick');
       const orderInput = card.querySelector('.order');
+      cb.checked = selected.has(pdf);
+      if (orderMap.has(pdf)) orderInput.value = orderMap.get(pdf);
 
       // Khi check/uncheck -> cập nhật selected
       cb.addEventListener('change', () => {
@@ -142,6 +187,7 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
           // KHÔNG xóa orderMap để người dùng quay lại vẫn còn thứ tự (tuỳ)
           // nếu muốn xoá luôn: orderMap.delete(pdf);
         }
+        saveBasket();
         syncBadge();
       });
 
@@ -150,65 +196,30 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
         const v = parseInt(orderInput.value || '0', 10);
         if (v > 0) orderMap.set(pdf, v);
         else orderMap.delete(pdf);
+        saveBasket();
       });
     });
   })();
 
-  // Build subject dropdown từ dữ liệu trên trang
-  (function initSubjects(){
-    const subjects = new Set();
-    Array.from(list.children).forEach(c => {
-      const s = (c.getAttribute('data-subject') || '').trim();
-      if (s) subjects.add(s);
-    });
-    const opts = Array.from(subjects).sort((a,b)=>a.localeCompare(b));
-    opts.forEach(s => {
-      const opt = document.createElement('option');
-      opt.value = s.toLowerCase();
-      opt.textContent = s;
-      subjectSel.appendChild(opt);
-    });
-  })();
-
-  function applyFilters() {
-    const term = (q.value || '').toLowerCase();
-    const subj = (subjectSel.value || '').toLowerCase();
-
-    let shown = 0;
-    Array.from(list.children).forEach(card => {
-      const title = (card.getAttribute('data-title')||'').toLowerCase();
-      const s = (card.getAttribute('data-subject')||'').toLowerCase();
-      const matchTitle = !term || title.includes(term);
-      const matchSubject = !subj || (s && (s === subj || s.includes(subj)));
-      const visible = matchTitle && matchSubject;
-      card.style.display = visible ? '' : 'none';
-
-      // Khôi phục trạng thái checkbox & order từ state
-      const pdf = card.getAttribute('data-pdf');
-      const cb = card.querySelector('.pick');
-      const orderInput = card.querySelector('.order');
-      cb.checked = selected.has(pdf);
-      if (orderMap.has(pdf)) orderInput.value = orderMap.get(pdf);
+  function syncBadge() {
+    // Hiển thị số lượng đang chọn (mọi trang, không phụ thuộc filter)
+    document.getElementById('selCount').textContent = 'Selected: ' + selected.size;
+  }
 
-      if (visible) shown++;
-    });
-    label.textContent = shown + ' items';
+  document.getElementById('clearSel').addEventListener('click', (e) => {
+    e.preventDefault();
+    selected.clear();
+    orderMap.clear();
+    saveBasket();
+    list.querySelectorAll('.pick').forEach(cb => { cb.checked = false; });
+    list.querySelectorAll('.order').forEach(o => { o.value = ''; });
     syncBadge();
-  }
+  });
 
-  function syncBadge() {
-    // Hiển thị số lượng đang chọn (không phụ thuộc filter)
-    const existing = document.getElementById('selCount');
-    const count = selected.size;
-    if (!existing) {
-      const span = document.createElement('span');
-      span.id = 'selCount';
-      span.className = 'small';
-      span.style.marginLeft = '8px';
-      subjectSel.insertAdjacentElement('afterend', span);
-    }
-    document.getElementById('selCount').textContent = 'Selected: ' + count;
-  }
+  // Bộ lọc chạy phía server: đổi subject / checkbox thì gửi form luôn
+  const filters = document.getElementById('filters');
+  document.getElementById('subject').addEventListener('change', () => filters.submit());
+  document.getElementById('hideUnresolved').addEventListener('change', () => filters.submit());
 
   function preview(btn) {
     const card = btn.closest('.card');
@@ -227,13 +238,86 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
     return arr.map(e => e.pdf);
   }
 
-  // initial render
-  (function firstRender(){
-    applyFilters(); // cũng sẽ sync lại checkbox/order nếu có
+  // Trạng thái crawl nền + báo khi catalog đã được nạp lại
+  (function pollStatus(){
+    const el = document.getElementById('crawlStatus');
+    const pageVersion = parseInt(el.getAttribute('data-version') || '0', 10);
+    async function tick() {
+      try {
+        const resp = await fetch('/status', {cache:'no-store'});
+        const st = await resp.json();
+        const c = st.crawl || {};
+        let txt = '';
+        if (c.state === 'running' && c.current) {
+          txt = 'Crawling ' + c.current.source + (c.current.page ? ' · page ' + c.current.page : '') + ' · +' + c.current.collected + ' items';
+        } else if (c.state === 'running') {
+          txt = 'Crawling…';
+        } else if (c.state === 'done' || c.state === 'stopped') {
+          const n = (c.done || []).reduce((a, p) => a + p.collected, 0);
+          txt = 'Crawl ' + c.state + ' · +' + n + ' items';
+        }
+        if (st.version > pageVersion) {
+          txt += (txt ? ' · ' : '') + 'catalog updated (' + st.items + ' items) — <a href="">reload</a>';
+        }
+        el.innerHTML = txt;
+        if (c.state === 'running' || st.version <= pageVersion) setTimeout(tick, 5000);
+      } catch (e) {
+        setTimeout(tick, 15000);
+      }
+    }
+    tick();
   })();
 
-  q.addEventListener('input', applyFilters);
-  subjectSel.addEventListener('change', applyFilters);
+  syncBadge();
+
+  // Tiến độ job merge: render từ JSON của /jobs/{id} (SSE hoặc poll)
+  const FILE_ICONS = {pending:'·', downloading:'⏳', done:'✅', cached:'✅', skipped:'⚠️'};
+  function esc(s) { return String(s).replace(/[&<>"']/g, c => ({'&':'&amp;','<':'&lt;','>':'&gt;','"':'&quot;',"'":'&#39;'}[c])); }
+  function renderJob(job) {
+    const status = document.getElementById('status');
+    const total = job.files.length;
+    let head = '';
+    switch (job.state) {
+      case 'queued': head = 'Queued…'; break;
+      case 'downloading': head = 'Downloading ' + job.done + '/' + total + '…'; break;
+      case 'merging': head = 'Merging ' + (total - (job.skipped || []).length) + ' PDFs…'; break;
+      case 'done': head = '✅ Done: <a href="' + esc(job.download) + '" target="_blank" rel="noreferrer">' + esc(job.download) + '</a>'; break;
+      case 'failed': head = '❌ ' + esc(job.error || 'Merge failed'); break;
+    }
+    let html = '<div>' + head + '</div>';
+    if (job.state === 'downloading' || job.state === 'queued') {
+      html += '<progress max="' + total + '" value="' + job.done + '" style="width:100%"></progress>';
+    }
+    if (job.skipped && job.skipped.length) {
+      html += '<div class="muted">Skipped: ' + job.skipped.length + '</div>';
+    }
+    html += '<ol class="small muted" style="max-height:160px; overflow:auto; padding-left:20px;">' + job.files.map(f =>
+      '<li title="' + esc(f.error || f.url) + '">' + (FILE_ICONS[f.state] || '') + ' ' + esc(titleMap.get(f.url) || f.url) + '</li>'
+    ).join('') + '</ol>';
+    status.innerHTML = html;
+  }
+
+  function followJob(job) {
+    return new Promise(resolve => {
+      if (window.EventSource) {
+        const es = new EventSource(job.events);
+        es.addEventListener('progress', e => renderJob(JSON.parse(e.data)));
+        es.addEventListener('done', e => { es.close(); renderJob(JSON.parse(e.data)); resolve(); });
+        es.onerror = () => { es.close(); poll(); };
+      } else {
+        poll();
+      }
+      // fallback: poll /jobs/{id}
+      async function poll() {
+        try {
+          const j = await (await fetch(job.status, {cache:'no-store'})).json();
+          renderJob(j);
+          if (j.state === 'done' || j.state === 'failed') return resolve();
+        } catch (e) {}
+        setTimeout(poll, 1000);
+      }
+    });
+  }
 
   document.getElementById('mergeBtn').addEventListener('click', async () => {
     const files = selection();
@@ -243,32 +327,23 @@ var page = template.Must(template.New("index").Funcs(funcMap).Parse(`
       status.innerHTML = '<span style="color:#c00">Chọn ít nhất 2 item.</span>';
       return;
     }
-    status.textContent = 'Downloading & merging...';
-    const resp = await fetch('/merge', {
-      method:'POST',
-      headers:{'Content-Type':'application/json'},
-      body: JSON.stringify({files, out})
-    });
-    if (resp.headers.get('Content-Type')?.includes('application/pdf')) {
-      // Trường hợp API trả stream PDF trực tiếp (khi deploy serverless)
-      const blob = await resp.blob();
-      const a = document.createElement('a');
-      a.href = URL.createObjectURL(blob);
-      a.download = out + '.pdf';
-      a.click();
-      status.innerHTML = '✅ Downloaded merged PDF.';
-      return;
-    }
-    const data = await resp.json().catch(()=>({}));
-    if (resp.ok) {
-      // Trường hợp server trả link tải
-      status.innerHTML = '✅ Done: '
-        + (data.download ? '<a href="'+data.download+'" target="_blank" rel="noreferrer">'+data.download+'</a>' : 'Merged');
-      if (data.skipped && data.skipped.length) {
-        status.innerHTML += '<div class="muted">Skipped: '+data.skipped.length+'</div>';
+    const btn = document.getElementById('mergeBtn');
+    btn.disabled = true;
+    status.textContent = 'Submitting…';
+    try {
+      const resp = await fetch('/merge', {
+        method:'POST',
+        headers:{'Content-Type':'application/json'},
+        body: JSON.stringify({files, out})
+      });
+      const data = await resp.json().catch(()=>({}));
+      if (!resp.ok) {
+        status.innerHTML = '❌ ' + esc(data?.error || 'Merge failed');
+        return;
       }
-    } else {
-      status.innerHTML = '❌ ' + (data?.error || 'Merge failed');
+      await followJob(data);
+    } finally {
+      btn.disabled = false;
     }
   });
 </script>
@@ -0,0 +1,283 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/image/draw"
+	_ "golang.org/x/image/webp"
+)
+
+// Kích thước thumbnail cho phép (px chiều ngang); card trong UI rộng ~260-400px.
+var thumbWidths = []int{200, 400, 800}
+
+const (
+	thumbDefaultWidth = 400
+	thumbMaxBytes     = 20 << 20
+	thumbRetryAfter   = 10 * time.Minute // img_url lỗi: không gọi lại upstream trước khoảng này
+	thumbCacheControl = "public, max-age=604800"
+)
+
+// thumbStore: ảnh img_url tải một lần về dir/orig, bản thu nhỏ theo từng
+// width ở dir/w<width>; tên file là sha256 của img_url.
+type thumbStore struct {
+	dir    string
+	client Fetcher
+
+	locks sync.Map // key -> *sync.Mutex, tránh tải/resize trùng cùng lúc
+
+	mu     sync.Mutex
+	failed map[string]time.Time
+}
+
+func newThumbStore(dir string, client Fetcher) (*thumbStore, error) {
+	if err := os.MkdirAll(filepath.Join(dir, "orig"), 0o755); err != nil {
+		return nil, err
+	}
+	return &thumbStore{dir: dir, client: client, failed: map[string]time.Time{}}, nil
+}
+
+func thumbKey(u string) string {
+	sum := sha256.Sum256([]byte(u))
+	return hex.EncodeToString(sum[:])
+}
+
+// snapThumbWidth làm tròn lên width cho phép gần nhất (0 = mặc định).
+func snapThumbWidth(w int) int {
+	if w <= 0 {
+		return thumbDefaultWidth
+	}
+	for _, tw := range thumbWidths {
+		if w <= tw {
+			return tw
+		}
+	}
+	return thumbWidths[len(thumbWidths)-1]
+}
+
+func (s *thumbStore) origPath(key string) string {
+	return filepath.Join(s.dir, "orig", key[:2], key)
+}
+
+func (s *thumbStore) sizedPath(key string, w int, ext string) string {
+	return filepath.Join(s.dir, "w"+strconv.Itoa(w), key[:2], key+ext)
+}
+
+func (s *thumbStore) lock(key string) func() {
+	m, _ := s.locks.LoadOrStore(key, &sync.Mutex{})
+	mu := m.(*sync.Mutex)
+	mu.Lock()
+	return mu.Unlock
+}
+
+// Thumb trả file ảnh width w cho img_url u, tải/resize nếu chưa có.
+// Ảnh đã hẹp hơn w thì giữ kích thước nhưng vẫn encode lại, nên /thumb chỉ
+// trả JPEG/PNG dù bản gốc là WebP hay GIF; ảnh không decode được (svg, html
+// lỗi, định dạng lạ) trả lỗi và bỏ bản gốc.
+func (s *thumbStore) Thumb(u string, w int) (string, error) {
+	key := thumbKey(u)
+	defer s.lock(key)()
+
+	for _, ext := range []string{".jpg", ".png"} {
+		if p := s.sizedPath(key, w, ext); fileExists(p) {
+			return p, nil
+		}
+	}
+	orig, err := s.original(u, key)
+	if err != nil {
+		return "", err
+	}
+	data, err := os.ReadFile(orig)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", s.undecodable(u, orig, err)
+	}
+
+	var thumb image.Image = img
+	if b := img.Bounds(); b.Dx() > w {
+		h := max(1, b.Dy()*w/b.Dx())
+		dst := image.NewRGBA(image.Rect(0, 0, w, h))
+		draw.CatmullRom.Scale(dst, dst.Bounds(), img, b, draw.Over, nil)
+		thumb = dst
+	}
+
+	var buf bytes.Buffer
+	ext := ".jpg"
+	if o, ok := img.(interface{ Opaque() bool }); ok && !o.Opaque() {
+		// giữ nền trong suốt (PNG worksheet hay có) -> PNG
+		ext = ".png"
+		err = png.Encode(&buf, thumb)
+	} else {
+		err = jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 82})
+	}
+	if err != nil {
+		return "", err
+	}
+	out := s.sizedPath(key, w, ext)
+	if err := os.MkdirAll(filepath.Dir(out), 0o755); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(out, buf.Bytes()); err != nil {
+		return "", err
+	}
+	return out, nil
+}
+
+// undecodable: bản gốc không phải ảnh đọc được -> xoá, coi như tải lỗi
+// (thử lại sau thumbRetryAfter) thay vì phục vụ nguyên bytes đó.
+func (s *thumbStore) undecodable(u, orig string, err error) error {
+	_ = os.Remove(orig)
+	s.mu.Lock()
+	s.failed[u] = time.Now()
+	s.mu.Unlock()
+	return fmt.Errorf("decode image: %w", err)
+}
+
+// original tải img_url về dir/orig nếu chưa có.
+func (s *thumbStore) original(u, key string) (string, error) {
+	p := s.origPath(key)
+	if fileExists(p) {
+		return p, nil
+	}
+	s.mu.Lock()
+	at, bad := s.failed[u]
+	s.mu.Unlock()
+	if bad && time.Since(at) < thumbRetryAfter {
+		return "", errors.New("recently failed")
+	}
+
+	data, err := fetchImage(s.client, u)
+	if err != nil {
+		s.mu.Lock()
+		s.failed[u] = time.Now()
+		s.mu.Unlock()
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(p, data); err != nil {
+		return "", err
+	}
+	return p, nil
+}
+
+func fetchImage(client Fetcher, u string) ([]byte, error) {
+	req, err := http.NewRequest("GET", u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", downloadUserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("http %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, thumbMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > thumbMaxBytes {
+		return nil, fmt.Errorf("image larger than %d bytes", thumbMaxBytes)
+	}
+	return data, nil
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// handleThumb: GET /thumb?u=<img_url>&w=<width>. Chỉ phục vụ img_url có
+// trong catalog để endpoint không thành proxy mở ra ngoài.
+func handleThumb(cat *Catalog, store *thumbStore) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		u := r.URL.Query().Get("u")
+		if u == "" || !cat.View().HasImage(u) {
+			http.NotFound(w, r)
+			return
+		}
+		width, _ := strconv.Atoi(r.URL.Query().Get("w"))
+		width = snapThumbWidth(width)
+
+		p, err := store.Thumb(u, width)
+		if err != nil {
+			log.Printf("[thumb] %s -> %v", u, err)
+			http.Error(w, "thumbnail unavailable", http.StatusBadGateway)
+			return
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			http.Error(w, "thumbnail unavailable", http.StatusInternalServerError)
+			return
+		}
+		defer f.Close()
+		st, err := f.Stat()
+		if err != nil {
+			http.Error(w, "thumbnail unavailable", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Cache-Control", thumbCacheControl)
+		w.Header().Set("ETag", `"`+filepath.Base(p)+"-"+strconv.FormatInt(st.Size(), 36)+`"`)
+		http.ServeContent(w, r, filepath.Base(p), st.ModTime(), f) // Content-Type theo đuôi .jpg/.png
+	}
+}
+
+// MirrorThumbs tải trước ảnh của mọi item trong dataPath và tạo sẵn thumbnail width w.
+func MirrorThumbs(dataPath string, store *thumbStore, w, workers int) error {
+	items, err := loadItems(dataPath)
+	if err != nil {
+		return err
+	}
+	var todo []string
+	seen := map[string]bool{}
+	for _, it := range items {
+		if it.IMGURL != "" && !seen[it.IMGURL] {
+			seen[it.IMGURL] = true
+			todo = append(todo, it.IMGURL)
+		}
+	}
+	w = snapThumbWidth(w)
+	log.Printf("[thumbs] %s: %d images -> %s (w=%d)", dataPath, len(todo), store.dir, w)
+
+	var mu sync.Mutex
+	done, failed := 0, 0
+	_ = forEachParallel(context.Background(), len(todo), workers, func(i int) {
+		_, err := store.Thumb(todo[i], w)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			log.Printf("  [thumbs] %s -> %v", todo[i], err)
+			failed++
+			return
+		}
+		done++
+		if done%100 == 0 {
+			log.Printf("[thumbs] %d/%d", done, len(todo))
+		}
+	})
+	log.Printf("[thumbs] done: %d ok, %d failed", done, failed)
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func pngBytes(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for x := 0; x < w; x++ {
+		img.Set(x, 0, color.RGBA{R: 255, A: 255})
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func gifBytes(t *testing.T, w, h int) string {
+	t.Helper()
+	img := image.NewPaletted(image.Rect(0, 0, w, h), color.Palette{color.White, color.Black})
+	var buf bytes.Buffer
+	if err := gif.Encode(&buf, img, nil); err != nil {
+		t.Fatal(err)
+	}
+	return buf.String()
+}
+
+func TestThumb(t *testing.T) {
+	srv := newScriptServer(t, map[string][]scriptStep{
+		"/big.png":   {{status: 200, contentType: "image/png", body: pngBytes(t, 900, 300)}},
+		"/small.png": {{status: 200, contentType: "image/png", body: pngBytes(t, 120, 90)}},
+		"/small.gif": {{status: 200, contentType: "image/gif", body: gifBytes(t, 120, 90)}},
+		"/page.png":  {{status: 200, contentType: "text/html", body: "<html>not an image</html>"}},
+	})
+	store, err := newThumbStore(t.TempDir(), http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("resized", func(t *testing.T) {
+		p, err := store.Thumb(srv.URL+"/big.png", 400)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f, err := os.Open(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		cfg, _, err := image.DecodeConfig(f)
+		if err != nil || cfg.Width != 400 || cfg.Height != 133 {
+			t.Errorf("thumb %s = %dx%d, %v; want 400x133", p, cfg.Width, cfg.Height, err)
+		}
+	})
+
+	t.Run("narrower than width is re-encoded, not resized", func(t *testing.T) {
+		tests := []struct {
+			path, ext, format string
+		}{
+			{"/small.png", ".png", "png"}, // có pixel trong suốt
+			{"/small.gif", ".jpg", "jpeg"},
+		}
+		for _, tc := range tests {
+			u := srv.URL + tc.path
+			for i := 0; i < 2; i++ {
+				p, err := store.Thumb(u, 400)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if want := store.sizedPath(thumbKey(u), 400, tc.ext); p != want {
+					t.Errorf("%s: path = %s, want %s", tc.path, p, want)
+				}
+				f, err := os.Open(p)
+				if err != nil {
+					t.Fatal(err)
+				}
+				cfg, format, err := image.DecodeConfig(f)
+				f.Close()
+				if err != nil || format != tc.format || cfg.Width != 120 || cfg.Height != 90 {
+					t.Errorf("%s: thumb = %s %dx%d, %v; want %s 120x90", tc.path, format, cfg.Width, cfg.Height, err, tc.format)
+				}
+			}
+			if got := srv.count(tc.path); got != 1 {
+				t.Errorf("%s: hits = %d, want 1", tc.path, got)
+			}
+		}
+	})
+
+	t.Run("undecodable original is an error", func(t *testing.T) {
+		u := srv.URL + "/page.png"
+		if p, err := store.Thumb(u, 400); err == nil {
+			t.Fatalf("want error, got %s", p)
+		}
+		if fileExists(store.origPath(thumbKey(u))) {
+			t.Error("undecodable original kept on disk")
+		}
+		// lỗi được nhớ: không gọi lại upstream ngay
+		if _, err := store.Thumb(u, 400); err == nil {
+			t.Fatal("want error on second call")
+		}
+		if got := srv.count("/page.png"); got != 1 {
+			t.Errorf("hits = %d, want 1", got)
+		}
+	})
+
+	if entries, _ := filepath.Glob(filepath.Join(store.dir, "w400", "*", "*")); len(entries) != 3 {
+		t.Errorf("w400 entries = %v, want the resized thumb and two re-encoded ones", entries)
+	}
+}
+
+// /thumb luôn trả JPEG/PNG với Content-Type đúng, kể cả khi ảnh gốc là GIF
+// và không cần thu nhỏ.
+func TestHandleThumbContentType(t *testing.T) {
+	srv := newScriptServer(t, map[string][]scriptStep{
+		"/small.gif": {{status: 200, contentType: "image/gif", body: gifBytes(t, 120, 90)}},
+		"/big.png":   {{status: 200, contentType: "image/png", body: pngBytes(t, 900, 300)}},
+	})
+	store, err := newThumbStore(t.TempDir(), http.DefaultClient)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cat := newCatalog([]Item{
+		{Title: "a", PDFURL: "https://x/a.pdf", IMGURL: srv.URL + "/small.gif"},
+		{Title: "b", PDFURL: "https://x/b.pdf", IMGURL: srv.URL + "/big.png"},
+	})
+	h := handleThumb(cat, store)
+	tests := []struct {
+		img, want string
+		status    int
+	}{
+		{srv.URL + "/small.gif", "image/jpeg", http.StatusOK},
+		{srv.URL + "/big.png", "image/png", http.StatusOK},
+		{srv.URL + "/other.png", "", http.StatusNotFound}, // không có trong catalog
+	}
+	for _, tc := range tests {
+		rec := httptest.NewRecorder()
+		h(rec, httptest.NewRequest("GET", "/thumb?w=400&u="+url.QueryEscape(tc.img), nil))
+		if rec.Code != tc.status {
+			t.Errorf("%s: status %d, want %d", tc.img, rec.Code, tc.status)
+			continue
+		}
+		if ct := rec.Header().Get("Content-Type"); tc.want != "" && ct != tc.want {
+			t.Errorf("%s: Content-Type = %q, want %q", tc.img, ct, tc.want)
+		}
+	}
+}
@@ -11,11 +11,21 @@ const (
 // ======================= DATA TYPES ===================
 
 type Item struct {
-	Title   string `json:"title"`
-	PDFURL  string `json:"pdf_url"`
-	IMGURL  string `json:"img_url"`
-	URL     string `json:"detail_url,omitempty"`
-	Subject string `json:"subject,omitempty"`
+	Title   string   `json:"title"`
+	PDFURL  string   `json:"pdf_url"`
+	IMGURL  string   `json:"img_url"`
+	URL     string   `json:"detail_url,omitempty"`
+	Source  string   `json:"source,omitempty"`  // tên Source đã cào ra item (kiddo, wsfun, ...)
+	Subject string   `json:"subject,omitempty"` // subject chính đã chuẩn hoá (subjects.go)
+	Tags    []string `json:"tags,omitempty"`    // mọi category/tag đã chuẩn hoá, subject chính đứng đầu
+
+	// do resolve pass điền (resolve.go)
+	LandingURL string `json:"landing_url,omitempty"` // pdf_url gốc (trang HTML) trước khi resolve
+	PDFStatus  string `json:"pdf_status,omitempty"`  // "", direct, resolved, unresolved
+
+	// do dedup theo nội dung điền (dedup.go)
+	SHA256  string   `json:"sha256,omitempty"`  // sha256 hex của file PDF
+	Aliases []string `json:"aliases,omitempty"` // pdf_url khác có cùng nội dung
 }
 
 type MergeRequest struct {
@@ -1,9 +1,11 @@
 package main
 
 import (
+	"context"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 )
 
 func sanitizeNoExt(s string) string {
@@ -37,3 +39,39 @@ func osRemoveAll(path string) error                   { return os.RemoveAll(path
 
 // join path helper
 func join(elem ...string) string { return filepath.Join(elem...) }
+
+func tern[T any](cond bool, a, b T) T {
+	if cond {
+		return a
+	}
+	return b
+}
+
+// forEachParallel gọi fn(i) cho i = 0..n-1 trên tối đa workers goroutine
+// và đợi tất cả xong. fn tự ghi kết quả vào ô i của slice riêng nên thứ tự
+// kết quả giữ theo input. ctx bị huỷ thì các i chưa bắt đầu bị bỏ qua và
+// trả về ctx.Err().
+func forEachParallel(ctx context.Context, n, workers int, fn func(i int)) error {
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < min(max(workers, 1), n); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	var err error
+	for i := 0; i < n && err == nil; i++ {
+		select {
+		case <-ctx.Done():
+			err = ctx.Err()
+		case jobs <- i:
+		}
+	}
+	close(jobs)
+	wg.Wait()
+	return err
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+// linkCheck: kết quả kiểm tra một URL của catalog.
+type linkCheck struct {
+	URL         string `json:"url"`
+	Kind        string `json:"kind"` // pdf | img | detail
+	OK          bool   `json:"ok"`
+	Verdict     string `json:"verdict"` // ok, via_html, http_error, not_pdf, not_image, no_pdf_link, error
+	Status      int    `json:"status,omitempty"`
+	ContentType string `json:"content_type,omitempty"`
+	Size        int64  `json:"size,omitempty"` // Content-Length, -1/0 = không rõ
+	FinalURL    string `json:"final_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+type verifyKindSummary struct {
+	Checked int            `json:"checked"`
+	OK      int            `json:"ok"`
+	Broken  int            `json:"broken"`
+	Verdict map[string]int `json:"verdicts"`
+}
+
+type verifyReport struct {
+	File        string                        `json:"file"`
+	GeneratedAt time.Time                     `json:"generated_at"`
+	Items       int                           `json:"items"`
+	BrokenItems int                           `json:"broken_items"` // item có pdf_url hỏng (merge sẽ skip)
+	Summary     map[string]*verifyKindSummary `json:"summary"`
+	Checks      []linkCheck                   `json:"checks"`
+}
+
+// VerifyCatalog: kiểm tra song song pdf_url, img_url, detail_url của mọi item
+// (mỗi URL một lần, qua client có rate limit/retry của crawler), ghi
+// <reportBase>.json + <reportBase>.txt. prunePath != "" thì ghi thêm catalog
+// chỉ gồm item có pdf_url dùng được (img_url hỏng thì xoá trống).
+// pdf_url được xét đúng theo luật của downloadPDF để khớp với /merge.
+func VerifyCatalog(path, reportBase, prunePath string, cfg CrawlConfig) error {
+	items, err := loadItems(path)
+	if err != nil {
+		return err
+	}
+	if cfg.Workers <= 0 {
+		cfg.Workers = 1
+	}
+	client, _ := newCrawlClient(cfg)
+	ua := downloadUserAgent
+
+	type job struct{ url, kind string }
+	var jobs []job
+	queued := map[string]bool{}
+	add := func(u, kind string) {
+		u = strings.TrimSpace(u)
+		if u == "" || queued[kind+" "+u] {
+			return
+		}
+		queued[kind+" "+u] = true
+		jobs = append(jobs, job{u, kind})
+	}
+	for _, it := range items {
+		add(it.PDFURL, "pdf")
+		add(it.IMGURL, "img")
+		add(it.URL, "detail")
+	}
+	log.Printf("[verify] %s: %d items, %d urls", path, len(items), len(jobs))
+
+	results := make([]linkCheck, len(jobs))
+	_ = forEachParallel(context.Background(), len(jobs), cfg.Workers, func(i int) {
+		results[i] = checkLink(client, ua, jobs[i].url, jobs[i].kind)
+	})
+
+	rep := verifyReport{File: path, GeneratedAt: time.Now(), Items: len(items), Summary: map[string]*verifyKindSummary{}, Checks: results}
+	byKey := make(map[string]linkCheck, len(results))
+	for _, c := range results {
+		byKey[c.Kind+" "+c.URL] = c
+		s := rep.Summary[c.Kind]
+		if s == nil {
+			s = &verifyKindSummary{Verdict: map[string]int{}}
+			rep.Summary[c.Kind] = s
+		}
+		s.Checked++
+		s.Verdict[c.Verdict]++
+		if c.OK {
+			s.OK++
+		} else {
+			s.Broken++
+		}
+	}
+
+	var kept []Item
+	for _, it := range items {
+		if c, ok := byKey["pdf "+strings.TrimSpace(it.PDFURL)]; ok && !c.OK {
+			rep.BrokenItems++
+			continue
+		}
+		if c, ok := byKey["img "+strings.TrimSpace(it.IMGURL)]; ok && !c.OK {
+			it.IMGURL = ""
+		}
+		kept = append(kept, it)
+	}
+
+	js, err := json.MarshalIndent(rep, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := writeFileAtomic(reportBase+".json", js); err != nil {
+		return err
+	}
+	summary := rep.text()
+	if err := writeFileAtomic(reportBase+".txt", []byte(summary)); err != nil {
+		return err
+	}
+	log.Printf("[verify] report: %s.json, %s.txt\n%s", reportBase, reportBase, summary)
+
+	if prunePath != "" {
+		if err := writeItemsAtomic(prunePath, kept); err != nil {
+			return err
+		}
+		log.Printf("[verify] pruned catalog: %s (%d of %d items)", prunePath, len(kept), len(items))
+	}
+	return nil
+}
+
+// text: bản tóm tắt cho người đọc.
+func (rep *verifyReport) text() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Link audit of %s (%s)\n", rep.File, rep.GeneratedAt.Format(time.RFC3339))
+	fmt.Fprintf(&b, "items: %d, items with a broken pdf_url: %d\n\n", rep.Items, rep.BrokenItems)
+	for _, kind := range []string{"pdf", "img", "detail"} {
+		s := rep.Summary[kind]
+		if s == nil {
+			continue
+		}
+		fmt.Fprintf(&b, "%-7s checked=%d ok=%d broken=%d", kind, s.Checked, s.OK, s.Broken)
+		verdicts := make([]string, 0, len(s.Verdict))
+		for v := range s.Verdict {
+			verdicts = append(verdicts, v)
+		}
+		sort.Strings(verdicts)
+		for _, v := range verdicts {
+			fmt.Fprintf(&b, " %s=%d", v, s.Verdict[v])
+		}
+		b.WriteString("\n")
+	}
+
+	var broken []linkCheck
+	for _, c := range rep.Checks {
+		if !c.OK && c.Kind == "pdf" {
+			broken = append(broken, c)
+		}
+	}
+	if len(broken) > 0 {
+		b.WriteString("\nbroken pdf_url:\n")
+		for _, c := range broken {
+			reason := c.Verdict
+			if c.Error != "" {
+				reason += ": " + c.Error
+			}
+			fmt.Fprintf(&b, "  %s (%s)\n", c.URL, reason)
+		}
+	}
+	return b.String()
+}
+
+// checkLink: HEAD trước, server từ chối HEAD thì GET. pdf là HTML thì làm
+// như downloadPDF: tìm link PDF trong trang rồi kiểm tra tiếp link đó.
+func checkLink(client *http.Client, ua, u, kind string) linkCheck {
+	c := linkCheck{URL: u, Kind: kind}
+	for hop := 0; ; hop++ {
+		resp, err := doProbe(context.Background(), client, "HEAD", ua, u)
+		if err == nil && (resp.StatusCode == http.StatusMethodNotAllowed || resp.StatusCode == http.StatusNotImplemented ||
+			resp.StatusCode == http.StatusForbidden || (kind == "pdf" && strings.Contains(strings.ToLower(resp.Header.Get("Content-Type")), "text/html"))) {
+			resp.Body.Close()
+			resp, err = doProbe(context.Background(), client, "GET", ua, u)
+		}
+		if err != nil {
+			c.Verdict, c.Error = "error", err.Error()
+			return c
+		}
+
+		c.Status = resp.StatusCode
+		c.ContentType = resp.Header.Get("Content-Type")
+		c.Size = resp.ContentLength
+		c.FinalURL = resp.Request.URL.String()
+		ct := strings.ToLower(c.ContentType)
+
+		var body []byte
+		if resp.Request.Method == "GET" && kind == "pdf" && strings.Contains(ct, "text/html") {
+			body, _ = io.ReadAll(io.LimitReader(resp.Body, resolveMaxHTML))
+		}
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode >= 400:
+			c.Verdict = "http_error"
+		case kind == "detail":
+			c.OK, c.Verdict = true, "ok"
+		case kind == "img":
+			c.OK = ct == "" || strings.HasPrefix(ct, "image/")
+			c.Verdict = tern(c.OK, "ok", "not_image")
+		case isPDFResponse(ct, u):
+			c.OK, c.Verdict = true, tern(hop == 0, "ok", "via_html")
+		case strings.Contains(ct, "text/html") && hop < resolveMaxHops:
+			next := findPDFLinkInHTML(string(body), u)
+			if next == "" || next == u {
+				c.Verdict = "no_pdf_link"
+				return c
+			}
+			u = next
+			continue
+		default:
+			c.Verdict = "not_pdf"
+		}
+		return c
+	}
+}
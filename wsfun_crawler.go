@@ -1,18 +1,10 @@
 package main
 
 import (
-	"bufio"
-	"encoding/json"
 	"fmt"
-	"log"
-	"net/http"
 	"net/url"
-	"os"
-	"path/filepath"
 	"regexp"
-	"sort"
 	"strings"
-	"time"
 
 	"github.com/PuerkitoBio/goquery"
 )
@@ -22,228 +14,42 @@ const (
 	wsfUserAgent = "WSFunCrawler-Items/1.0 (+https://example.local)"
 )
 
-type WSFCheckpoint struct {
-	LastPage int `json:"last_page"`
+func init() {
+	registerSource("wsfun", func(listURL string) Source { return wsfSource{Category: listURL} })
 }
 
-type WSFCrawlConfig struct {
-	DataPath        string
-	CPPath          string
-	StartPage       int
-	EndPage         int // 0 = auto detect; với BaseCategoryURL + LazyExhaust => bỏ qua, cào đến khi dừng
-	DelayMs         int
-	MaxItems        int    // 0 = unlimited
-	BaseCategoryURL string // nếu set, cào theo category này
-	LazyExhaust     bool   // true: tăng /page/N/ tới khi lỗi/không còn bài
-	EmptyPageLimit  int    // số trang trống liên tiếp để dừng (mặc định 3 nếu =0)
-	Retry           int    // số lần retry tải trang list (mặc định 2 nếu =0)
+// wsfSource: worksheetfun.com; Category rỗng = phân trang trang chủ.
+type wsfSource struct {
+	Category string
 }
 
-// ---------- Public runner ----------
-
-func RunWSFunCrawlerWithCheckpoint(cfg WSFCrawlConfig) error {
-	client := &http.Client{Timeout: 30 * time.Second}
-
-	// defaults
-	if cfg.EmptyPageLimit <= 0 {
-		cfg.EmptyPageLimit = 3
-	}
-	if cfg.Retry <= 0 {
-		cfg.Retry = 2
-	}
-
-	// checkpoint -> start
-	cp, _ := wsfReadCheckpoint(cfg.CPPath)
-	start := cfg.StartPage
-	if cp.LastPage > 0 {
-		start = cp.LastPage + 1
-	}
-	if start < 1 {
-		start = 1
-	}
-
-	// ensure data dir
-	if err := osMkdirAll(filepath.Dir(absPath(cfg.DataPath)), 0o755); err != nil && !os.IsExist(err) {
-		return err
-	}
+func (wsfSource) Name() string      { return "wsfun" }
+func (wsfSource) UserAgent() string { return wsfUserAgent }
+func (s wsfSource) ListURL(p int) string {
+	return wsfCatOrRootURL(s.Category, p)
+}
 
-	// nạp dữ liệu cũ để dedup theo pdf_url
-	existing, _ := loadItems(cfg.DataPath)
-	seen := make(map[string]struct{}, len(existing))
-	for _, it := range existing {
-		if it.PDFURL != "" {
-			seen[strings.TrimSpace(it.PDFURL)] = struct{}{}
-		}
-	}
+// Lazy: có category (và không set EndPage) thì cào tới khi hết bài.
+func (s wsfSource) Lazy() bool {
+	return strings.TrimSpace(s.Category) != ""
+}
 
-	// Quyết định chiến lược phân trang
-	useLazy := cfg.LazyExhaust || (strings.TrimSpace(cfg.BaseCategoryURL) != "" && cfg.EndPage == 0)
-
-	// Tính end nếu không dùng lazy
-	end := cfg.EndPage
-	if !useLazy && end == 0 {
-		var err error
-		if strings.TrimSpace(cfg.BaseCategoryURL) != "" {
-			end, err = wsfFindMaxPagesForCategory(client, cfg.BaseCategoryURL)
-		} else {
-			end, err = wsfFindMaxPages(client)
-		}
-		if err != nil {
-			log.Printf("[wsfun] cannot detect max pages: %v, fallback 100", err)
-			end = 100
-		}
+func (s wsfSource) FindMaxPages(client Fetcher) (int, error) {
+	if strings.TrimSpace(s.Category) != "" {
+		return wsfFindMaxPagesForCategory(client, s.Category)
 	}
+	return wsfFindMaxPages(client)
+}
 
-	log.Printf("[wsfun] crawl start=%d strategy=%s end=%d data=%s cp=%s",
-		start, tern(useLazy, "lazy-exhaust", "bounded"), end, cfg.DataPath, cfg.CPPath)
-
-	var batch []Item
-	collected := 0
-
-	if useLazy {
-		// -------- Lazy exhaust mode: tăng /page/N/ đến khi dừng --------
-		emptyRun := 0
-		for p := start; ; p++ {
-			listURL := wsfCatOrRootURL(cfg.BaseCategoryURL, p)
-			log.Printf("[wsfun] page %d: %s", p, listURL)
-
-			doc, err := wsfFetchDocWithRetry(client, listURL, cfg.Retry)
-			if err != nil {
-				log.Printf("[wsfun] stop on error page %d: %v", p, err)
-				_ = wsfWriteCheckpoint(cfg.CPPath, p)
-				break
-			}
-
-			detailLinks, thumbMap := wsfExtractDetailLinks(doc)
-			if len(detailLinks) == 0 {
-				emptyRun++
-				log.Printf("[wsfun] page %d: no detail links (emptyRun=%d)", p, emptyRun)
-				_ = wsfWriteCheckpoint(cfg.CPPath, p)
-				if emptyRun >= cfg.EmptyPageLimit {
-					log.Printf("[wsfun] stop on empty pages (limit=%d)", cfg.EmptyPageLimit)
-					break
-				}
-				// nghỉ một chút rồi tiếp
-				time.Sleep(time.Duration(cfg.DelayMs) * time.Millisecond)
-				continue
-			}
-			emptyRun = 0 // reset vì có bài
-
-			for _, durl := range detailLinks {
-				if cfg.MaxItems > 0 && collected >= cfg.MaxItems {
-					break
-				}
-				time.Sleep(time.Duration(cfg.DelayMs) * time.Millisecond)
-
-				it, err := wsfParseDetail(client, durl)
-				if err != nil {
-					log.Printf("  [wsfun/detail] %s -> %v", durl, err)
-					continue
-				}
-				// thumbnail fallback từ listing
-				if it.IMGURL == "" {
-					if tb, ok := thumbMap[durl]; ok {
-						it.IMGURL = tb
-					}
-				}
-				// đủ dữ liệu + chưa trùng pdf_url
-				if it.Title == "" || it.PDFURL == "" {
-					continue
-				}
-				key := strings.TrimSpace(it.PDFURL)
-				if _, ok := seen[key]; ok {
-					continue
-				}
-				seen[key] = struct{}{}
-				batch = append(batch, it)
-				collected++
-			}
-
-			// ghi batch định kỳ
-			if len(batch) > 0 {
-				if err := wsfAppendItems(cfg.DataPath, batch); err != nil {
-					return err
-				}
-				batch = batch[:0]
-			}
-
-			// checkpoint sau mỗi trang
-			if err := wsfWriteCheckpoint(cfg.CPPath, p); err != nil {
-				log.Printf("[wsfun] warn write checkpoint: %v", err)
-			}
-
-			if cfg.MaxItems > 0 && collected >= cfg.MaxItems {
-				break
-			}
-		}
-
-	} else {
-		// -------- Bounded mode: p in [start..end] --------
-		for p := start; p <= end; p++ {
-			listURL := wsfCatOrRootURL(cfg.BaseCategoryURL, p)
-			log.Printf("[wsfun] page %d: %s", p, listURL)
-
-			doc, err := wsfFetchDocWithRetry(client, listURL, cfg.Retry)
-			if err != nil {
-				log.Printf("[wsfun] skip page %d: %v", p, err)
-				_ = wsfWriteCheckpoint(cfg.CPPath, p)
-				continue
-			}
-
-			detailLinks, thumbMap := wsfExtractDetailLinks(doc)
-			if len(detailLinks) == 0 {
-				log.Printf("[wsfun] page %d: no detail links", p)
-				_ = wsfWriteCheckpoint(cfg.CPPath, p)
-				continue
-			}
-
-			for _, durl := range detailLinks {
-				if cfg.MaxItems > 0 && collected >= cfg.MaxItems {
-					break
-				}
-				time.Sleep(time.Duration(cfg.DelayMs) * time.Millisecond)
-
-				it, err := wsfParseDetail(client, durl)
-				if err != nil {
-					log.Printf("  [wsfun/detail] %s -> %v", durl, err)
-					continue
-				}
-				if it.IMGURL == "" {
-					if tb, ok := thumbMap[durl]; ok {
-						it.IMGURL = tb
-					}
-				}
-				if it.Title == "" || it.PDFURL == "" {
-					continue
-				}
-				key := strings.TrimSpace(it.PDFURL)
-				if _, ok := seen[key]; ok {
-					continue
-				}
-				seen[key] = struct{}{}
-				batch = append(batch, it)
-				collected++
-			}
-
-			if len(batch) > 0 {
-				if err := wsfAppendItems(cfg.DataPath, batch); err != nil {
-					return err
-				}
-				batch = batch[:0]
-			}
+func (wsfSource) SitemapURL() string        { return wsfBaseURL + "/sitemap.xml" }
+func (wsfSource) IsDetailURL(u string) bool { return wsfIsDetailURL(u) }
 
-			if err := wsfWriteCheckpoint(cfg.CPPath, p); err != nil {
-				log.Printf("[wsfun] warn write checkpoint: %v", err)
-			}
-
-			if cfg.MaxItems > 0 && collected >= cfg.MaxItems {
-				break
-			}
-		}
-	}
+func (wsfSource) ExtractDetailLinks(doc *goquery.Document) ([]string, map[string]string) {
+	return wsfExtractDetailLinks(doc)
+}
 
-	log.Printf("[wsfun] collected %d new items", collected)
-	return nil
+func (wsfSource) ParseDetail(client Fetcher, detailURL string) ([]Item, error) {
+	return wsfParseDetail(client, detailURL)
 }
 
 // ---------- List & pagination ----------
@@ -263,35 +69,11 @@ func wsfListURL(p int) string {
 	return fmt.Sprintf("%s/page/%d/", wsfBaseURL, p)
 }
 
-func wsfFetchDoc(client *http.Client, u string) (*goquery.Document, error) {
-	req, _ := http.NewRequest("GET", u, nil)
-	req.Header.Set("User-Agent", wsfUserAgent)
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
-	if resp.StatusCode >= 400 {
-		return nil, fmt.Errorf("http %d", resp.StatusCode)
-	}
-	return goquery.NewDocumentFromReader(resp.Body)
+func wsfFetchDoc(client Fetcher, u string) (*goquery.Document, error) {
+	return fetchDocUA(client, u, wsfUserAgent)
 }
 
-// retry đơn giản cho trang list
-func wsfFetchDocWithRetry(client *http.Client, u string, retry int) (*goquery.Document, error) {
-	var lastErr error
-	for i := 0; i <= retry; i++ {
-		doc, err := wsfFetchDoc(client, u)
-		if err == nil {
-			return doc, nil
-		}
-		lastErr = err
-		time.Sleep(500 * time.Millisecond)
-	}
-	return nil, lastErr
-}
-
-func wsfFindMaxPages(client *http.Client) (int, error) {
+func wsfFindMaxPages(client Fetcher) (int, error) {
 	doc, err := wsfFetchDoc(client, wsfListURL(1))
 	if err != nil {
 		return 0, err
@@ -393,22 +175,22 @@ func wsfAbs(href string) string {
 
 // ---------- Detail parsing ----------
 
-func wsfParseDetail(client *http.Client, detailURL string) (Item, error) {
+func wsfParseDetail(client Fetcher, detailURL string) ([]Item, error) {
 	// NEW: nếu detailURL là PDF trực tiếp (trường hợp #post-XXXX > a trỏ thẳng .pdf)
 	if strings.HasSuffix(strings.ToLower(detailURL), ".pdf") {
-		return Item{
+		return []Item{{
 			Title:   fallbackTitle(detailURL), // dùng tên file làm title fallback
 			PDFURL:  detailURL,
 			IMGURL:  "", // có thể được gán từ thumbMap ở caller
 			URL:     detailURL,
 			Subject: "", // thường không rõ ở list; có thể suy từ category nếu cần
-		}, nil
+		}}, nil
 	}
 
 	// (phần còn lại giữ nguyên như cũ)
 	doc, err := wsfFetchDoc(client, detailURL)
 	if err != nil {
-		return Item{}, err
+		return nil, err
 	}
 
 	// Title: ưu tiên h1.entry-title; fallback title tag
@@ -417,7 +199,7 @@ func wsfParseDetail(client *http.Client, detailURL string) (Item, error) {
 		title = strings.TrimSpace(doc.Find("title").First().Text())
 	}
 
-	// Subject: lấy từ categories/tags
+	// Subject: lấy từ categories/tags (giữ tất cả làm tags)
 	subject := ""
 	var subjects []string
 	doc.Find(`a[rel="category tag"], a[href*="/category/"], a[rel="tag"], a[href*="/tag/"]`).Each(func(_ int, s *goquery.Selection) {
@@ -432,24 +214,8 @@ func wsfParseDetail(client *http.Client, detailURL string) (Item, error) {
 		subject = subjects[0]
 	}
 
-	// PDF: .pdf hoặc anchor có chữ download/pdf
-	var pdf string
-	doc.Find("a[href]").Each(func(_ int, a *goquery.Selection) {
-		h, _ := a.Attr("href")
-		abs := wsfAbs(h)
-		txt := strings.ToLower(strings.TrimSpace(a.Text()))
-		l := strings.ToLower(abs)
-		switch {
-		case strings.HasSuffix(l, ".pdf"):
-			if pdf == "" {
-				pdf = abs
-			}
-		case strings.Contains(txt, "download") || strings.Contains(txt, "pdf"):
-			if pdf == "" {
-				pdf = abs
-			}
-		}
-	})
+	// PDF: mọi link .pdf (mỗi link một item); không có thì anchor có chữ download/pdf
+	pdfs := collectPDFLinks(doc, "a[href]", []string{".pdf"}, []string{"download", "pdf"}, wsfAbs)
 
 	// Image/thumbnail: prefer og:image; else ảnh đầu trong nội dung
 	var img string
@@ -466,92 +232,16 @@ func wsfParseDetail(client *http.Client, detailURL string) (Item, error) {
 		}
 	}
 
-	return Item{
+	return pdfItems(Item{
 		Title:   cleanText(title),
-		PDFURL:  pdf,
 		IMGURL:  img,
 		URL:     detailURL,
 		Subject: subject,
-	}, nil
-}
-
-// ---------- Append JSON & helpers ----------
-
-func wsfAppendItems(path string, items []Item) error {
-	if len(items) == 0 {
-		return nil
-	}
-	// JSONL
-	if strings.HasSuffix(strings.ToLower(path), ".jsonl") {
-		f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
-		if err != nil {
-			return err
-		}
-		defer f.Close()
-		w := bufio.NewWriter(f)
-		enc := json.NewEncoder(w)
-		for _, it := range items {
-			if err := enc.Encode(it); err != nil {
-				return err
-			}
-		}
-		return w.Flush()
-	}
-
-	// JSON array
-	existing, _ := loadItems(path)
-	existing = append(existing, items...)
-	sort.Slice(existing, func(i, j int) bool {
-		return strings.ToLower(existing[i].Title) < strings.ToLower(existing[j].Title)
-	})
-	tmp := path + ".tmp"
-	f, err := os.Create(tmp)
-	if err != nil {
-		return err
-	}
-	enc := json.NewEncoder(f)
-	enc.SetIndent("", "  ")
-	if err := enc.Encode(existing); err != nil {
-		f.Close()
-		_ = os.Remove(tmp)
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-	return os.Rename(tmp, path)
+		Tags:    subjects,
+	}, pdfs), nil
 }
 
-func wsfReadCheckpoint(path string) (WSFCheckpoint, error) {
-	var cp WSFCheckpoint
-	f, err := os.Open(path)
-	if err != nil {
-		return cp, err
-	}
-	defer f.Close()
-	if err := json.NewDecoder(f).Decode(&cp); err != nil {
-		return cp, err
-	}
-	return cp, nil
-}
-
-func wsfWriteCheckpoint(path string, page int) error {
-	tmp := path + ".tmp"
-	f, err := os.Create(tmp)
-	if err != nil {
-		return err
-	}
-	cp := WSFCheckpoint{LastPage: page}
-	if err := json.NewEncoder(f).Encode(&cp); err != nil {
-		f.Close()
-		_ = os.Remove(tmp)
-		return err
-	}
-	if err := f.Close(); err != nil {
-		return err
-	}
-	return os.Rename(tmp, path)
-}
+// ---------- Category helpers ----------
 
 // Chuẩn hoá URL category: đảm bảo có /page/1 hoặc có trailing slash
 func wsfNormalizeCatURL(u string) string {
@@ -583,7 +273,7 @@ func wsfCatPageURL(baseCat string, n int) string {
 	return re.ReplaceAllString(baseCat, fmt.Sprintf("${1}%d${3}", n))
 }
 
-func wsfFindMaxPagesForCategory(client *http.Client, baseCat string) (int, error) {
+func wsfFindMaxPagesForCategory(client Fetcher, baseCat string) (int, error) {
 	baseCat = wsfNormalizeCatURL(baseCat)
 	doc, err := wsfFetchDoc(client, wsfCatPageURL(baseCat, 1))
 	if err != nil {
@@ -604,12 +294,3 @@ func wsfFindMaxPagesForCategory(client *http.Client, baseCat string) (int, error
 	})
 	return max, nil
 }
-
-// ---- small utils ----
-
-func tern[T any](cond bool, a, b T) T {
-	if cond {
-		return a
-	}
-	return b
-}